@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// apiRoute describes one JSON endpoint. The same definitions register the
+// handlers and generate the OpenAPI document, so the two can't drift.
+type apiRoute struct {
+	method  string
+	path    string
+	summary string
+	// paged routes accept the limit and offset query parameters.
+	paged bool
+	// request and response are zero values of the JSON body types; a nil
+	// response means the route answers 204 No Content.
+	request  any
+	response any
+	handle   func(s *state, r *http.Request, user database.User) (any, error)
+}
+
+var apiRoutes = []apiRoute{
+	{method: "GET", path: "/api/users", summary: "List users", paged: true, response: apiPage[apiUser]{}, handle: apiListUsers},
+	{method: "GET", path: "/api/feeds", summary: "List feeds", paged: true, response: apiPage[apiFeed]{}, handle: apiListFeeds},
+	{method: "POST", path: "/api/feeds", summary: "Add a feed and follow it", request: apiAddFeedRequest{}, response: apiFeed{}, handle: apiAddFeed},
+	{method: "GET", path: "/api/follows", summary: "List the feeds followed by the user", paged: true, response: apiPage[apiFollow]{}, handle: apiListFollows},
+	{method: "POST", path: "/api/follows", summary: "Follow a feed by URL", request: apiFollowRequest{}, response: apiFollow{}, handle: apiFollowFeed},
+	{method: "DELETE", path: "/api/follows/{feed_id}", summary: "Unfollow a feed", handle: apiUnfollowFeed},
+	{method: "GET", path: "/api/posts", summary: "List the newest posts of followed feeds", paged: true, response: apiPage[apiPost]{}, handle: apiListPosts},
+}
+
+type apiUser struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type apiFeed struct {
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	UserID        uuid.UUID  `json:"user_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
+	Authenticated bool       `json:"authenticated"`
+}
+
+type apiFollow struct {
+	FeedID     uuid.UUID `json:"feed_id"`
+	FeedName   string    `json:"feed_name"`
+	FeedURL    string    `json:"feed_url"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type apiPost struct {
+	ID          uuid.UUID      `json:"id"`
+	Title       string         `json:"title"`
+	URL         string         `json:"url"`
+	FeedID      uuid.UUID      `json:"feed_id"`
+	FeedName    string         `json:"feed_name"`
+	PublishedAt *time.Time     `json:"published_at"`
+	Author      string         `json:"author,omitempty"`
+	Categories  []string       `json:"categories"`
+	CommentsURL string         `json:"comments_url,omitempty"`
+	Description string         `json:"description"`
+	Content     string         `json:"content,omitempty"`
+	Enclosures  []apiEnclosure `json:"enclosures"`
+}
+
+type apiEnclosure struct {
+	URL             string `json:"url"`
+	MimeType        string `json:"mime_type,omitempty"`
+	Length          int64  `json:"length,omitempty"`
+	DurationSeconds int32  `json:"duration_seconds,omitempty"`
+}
+
+type apiPage[T any] struct {
+	Items  []T `json:"items"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type apiAddFeedRequest struct {
+	Name     string            `json:"name"`
+	URL      string            `json:"url"`
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+type apiFollowRequest struct {
+	URL string `json:"url"`
+}
+
+// apiErrorBody is the body of every error response.
+type apiErrorBody struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// apiError is returned by route handlers to choose the error response.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func badRequest(format string, args ...any) *apiError {
+	return &apiError{Status: http.StatusBadRequest, Code: "invalid_request", Message: fmt.Sprintf(format, args...)}
+}
+
+// registerAPI adds apiRoutes and the OpenAPI document to mux.
+func (s *state) registerAPI(mux *http.ServeMux) {
+	for _, route := range apiRoutes {
+		mux.HandleFunc(route.method+" "+route.path, s.apiHandler(route))
+	}
+	mux.HandleFunc("GET /api/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, openAPISpec(apiRoutes))
+	})
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "no such endpoint"})
+	})
+}
+
+func (s *state) apiHandler(route apiRoute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := s.apiUser(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		result, err := route.handle(s, r, user)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		switch {
+		case result == nil:
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "POST":
+			writeJSON(w, http.StatusCreated, result)
+		default:
+			writeJSON(w, http.StatusOK, result)
+		}
+	}
+}
+
+// apiUser is the server's middlewareLoggedIn: it resolves the user owning
+// the bearer token of the request, instead of trusting the config file.
+func (s *state) apiUser(r *http.Request) (database.User, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return database.User{}, &apiError{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "missing bearer token"}
+	}
+	user, err := s.userForToken(r.Context(), strings.TrimSpace(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, &apiError{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "invalid or revoked token"}
+	}
+	return user, err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Error("couldn't write response", "error", err)
+	}
+}
+
+// writeAPIError maps err onto a status code and the common error body.
+// Unexpected errors are logged and reported without their details.
+func writeAPIError(w http.ResponseWriter, err error) {
+	var apiErr *apiError
+	switch {
+	case errors.As(err, &apiErr):
+		if apiErr.Status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gator"`)
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		apiErr = &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "not found"}
+	case strings.Contains(err.Error(), "duplicate key value violates unique constraint"):
+		apiErr = &apiError{Status: http.StatusConflict, Code: "conflict", Message: "already exists"}
+	default:
+		slog.Error("API request failed", "error", err)
+		apiErr = &apiError{Status: http.StatusInternalServerError, Code: "internal", Message: "internal error"}
+	}
+
+	body := apiErrorBody{}
+	body.Error.Code = apiErr.Code
+	body.Error.Message = apiErr.Message
+	writeJSON(w, apiErr.Status, body)
+}
+
+// pageParams reads the limit and offset query parameters.
+func pageParams(r *http.Request) (limit, offset int, err error) {
+	limit, offset = defaultPageSize, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, badRequest("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, badRequest("offset must be a positive number")
+		}
+	}
+	return limit, offset, nil
+}
+
+func decodeRequest(r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequest("invalid request body: %v", err)
+	}
+	return nil
+}
+
+func optionalTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func toAPIFeed(feed database.Feed) apiFeed {
+	return apiFeed{
+		ID:            feed.ID,
+		Name:          feed.Name,
+		URL:           feed.Url,
+		UserID:        feed.UserID,
+		CreatedAt:     feed.CreatedAt,
+		UpdatedAt:     feed.UpdatedAt,
+		LastFetchedAt: optionalTime(feed.LastFetchedAt),
+		Authenticated: len(feed.Credentials) > 0,
+	}
+}
+
+func apiListUsers(s *state, r *http.Request, _ database.User) (any, error) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.db.ListUsers(r.Context(), database.ListUsersParams{Limit: int32(limit), Offset: int32(offset)})
+	if err != nil {
+		return nil, err
+	}
+	page := apiPage[apiUser]{Items: []apiUser{}, Limit: limit, Offset: offset}
+	for _, user := range users {
+		page.Items = append(page.Items, apiUser{ID: user.ID, Name: user.Name, CreatedAt: user.CreatedAt})
+	}
+	return page, nil
+}
+
+func apiListFeeds(s *state, r *http.Request, _ database.User) (any, error) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		return nil, err
+	}
+	feeds, err := s.db.ListFeeds(r.Context(), database.ListFeedsParams{Limit: int32(limit), Offset: int32(offset)})
+	if err != nil {
+		return nil, err
+	}
+	page := apiPage[apiFeed]{Items: []apiFeed{}, Limit: limit, Offset: offset}
+	for _, feed := range feeds {
+		page.Items = append(page.Items, toAPIFeed(feed))
+	}
+	return page, nil
+}
+
+func apiAddFeed(s *state, r *http.Request, user database.User) (any, error) {
+	req := apiAddFeedRequest{}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	if req.Name == "" || req.URL == "" {
+		return nil, badRequest("name and url are required")
+	}
+	creds := feedCredentials{Username: req.Username, Password: req.Password, Headers: req.Headers}
+	feed, _, err := addFeed(r.Context(), s, user, req.Name, req.URL, creds)
+	if errors.Is(err, errNoSecretKey) {
+		return nil, badRequest("credentials can't be stored: the server has no secret key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toAPIFeed(feed), nil
+}
+
+func apiListFollows(s *state, r *http.Request, user database.User) (any, error) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		return nil, err
+	}
+	follows, err := s.db.ListFeedFollowsForUser(r.Context(), database.ListFeedFollowsForUserParams{
+		UserID: user.ID,
+		Limit:  int32(limit),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	page := apiPage[apiFollow]{Items: []apiFollow{}, Limit: limit, Offset: offset}
+	for _, follow := range follows {
+		page.Items = append(page.Items, apiFollow{
+			FeedID:     follow.FeedID,
+			FeedName:   follow.FeedName,
+			FeedURL:    follow.FeedUrl,
+			FollowedAt: follow.CreatedAt,
+		})
+	}
+	return page, nil
+}
+
+func apiFollowFeed(s *state, r *http.Request, user database.User) (any, error) {
+	req := apiFollowRequest{}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	if req.URL == "" {
+		return nil, badRequest("url is required")
+	}
+	feed, err := s.db.GetFeedByUrl(r.Context(), req.URL)
+	if err != nil {
+		return nil, err
+	}
+	follow, err := followFeed(r.Context(), s, user, feed)
+	if err != nil {
+		return nil, err
+	}
+	return apiFollow{
+		FeedID:     follow.FeedID,
+		FeedName:   follow.FeedName,
+		FeedURL:    feed.Url,
+		FollowedAt: follow.CreatedAt,
+	}, nil
+}
+
+func apiUnfollowFeed(s *state, r *http.Request, user database.User) (any, error) {
+	feedID, err := uuid.Parse(r.PathValue("feed_id"))
+	if err != nil {
+		return nil, badRequest("invalid feed id")
+	}
+	removed, err := s.db.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{
+		UserID: user.ID,
+		FeedID: feedID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if removed == 0 {
+		return nil, &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "not following that feed"}
+	}
+	return nil, nil
+}
+
+func apiListPosts(s *state, r *http.Request, user database.User) (any, error) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := s.db.ListPostsForUser(r.Context(), database.ListPostsForUserParams{
+		UserID: user.ID,
+		Limit:  int32(limit),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	postIDs := make([]uuid.UUID, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.ID
+	}
+	enclosures, err := postEnclosures(r.Context(), s, postIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	page := apiPage[apiPost]{Items: []apiPost{}, Limit: limit, Offset: offset}
+	for _, post := range posts {
+		item := apiPost{
+			ID:          post.ID,
+			Title:       post.Title,
+			URL:         post.Url,
+			FeedID:      post.FeedID,
+			FeedName:    post.FeedName,
+			PublishedAt: optionalTime(post.PublishedAt),
+			Author:      post.Author.String,
+			Categories:  post.Categories,
+			CommentsURL: post.CommentsUrl.String,
+			Description: post.Description.String,
+			Content:     post.Content.String,
+			Enclosures:  toAPIEnclosures(enclosures[post.ID]),
+		}
+		page.Items = append(page.Items, item)
+	}
+	return page, nil
+}
+
+func toAPIEnclosures(enclosures []database.Enclosure) []apiEnclosure {
+	items := []apiEnclosure{}
+	for _, e := range enclosures {
+		items = append(items, apiEnclosure{
+			URL:             e.Url,
+			MimeType:        e.MimeType.String,
+			Length:          e.Length.Int64,
+			DurationSeconds: e.DurationSeconds.Int32,
+		})
+	}
+	return items
+}
+
+// postEnclosures returns the enclosures of the given posts, by post.
+func postEnclosures(ctx context.Context, s *state, postIDs []uuid.UUID) (map[uuid.UUID][]database.Enclosure, error) {
+	enclosures, err := s.db.GetEnclosuresForPosts(ctx, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	byPost := map[uuid.UUID][]database.Enclosure{}
+	for _, e := range enclosures {
+		byPost[e.PostID] = append(byPost[e.PostID], e)
+	}
+	return byPost, nil
+}
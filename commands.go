@@ -1,7 +1,14 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/zyaeger/gator/internal/output"
 )
 
 type command struct {
@@ -13,6 +20,13 @@ type commands struct {
 	cmdToHandler map[string]func(*state, command) error
 }
 
+// globalOptions are the flags accepted by every command.
+type globalOptions struct {
+	output output.Format
+	// logFormat is empty unless --log-format was given.
+	logFormat string
+}
+
 func (c *commands) run(s *state, cmd command) error {
 	handler, exists := c.cmdToHandler[cmd.Name]
 	if !exists {
@@ -25,3 +39,75 @@ func (c *commands) run(s *state, cmd command) error {
 func (c *commands) register(name string, f func(*state, command) error) {
 	c.cmdToHandler[name] = f
 }
+
+// usage lists the global flags and the registered commands.
+func (c *commands) usage() string {
+	names := slices.Sorted(maps.Keys(c.cmdToHandler))
+	return "usage: gator [--output text|json|csv|tsv] [--log-format text|json] <command> [args...]\n\ncommands: " + strings.Join(names, ", ")
+}
+
+// parseGlobalFlags reads the global flags given before the command and
+// returns the command name and its arguments. Flags after the command are
+// left to it, so commands may define flags of the same name.
+func parseGlobalFlags(args []string) (globalOptions, []string, error) {
+	opts := globalOptions{output: output.Text}
+
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		switch name {
+		case "--output", "--log-format":
+		default:
+			return opts, args[i:], nil
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("flag %s requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "--output":
+			format, err := output.ParseFormat(value)
+			if err != nil {
+				return opts, nil, err
+			}
+			opts.output = format
+		case "--log-format":
+			if err := checkLogFormat(value); err != nil {
+				return opts, nil, err
+			}
+			opts.logFormat = value
+		}
+	}
+	return opts, nil, nil
+}
+
+// noArgs returns a usage error when a command that takes no arguments is
+// given some. Those are most likely global flags given after the command,
+// which would otherwise be ignored.
+func noArgs(cmd command) error {
+	if len(cmd.Args) == 0 {
+		return nil
+	}
+	return fmt.Errorf("usage: %s (global flags such as --output go before the command)", cmd.Name)
+}
+
+// parseArgs parses the flags defined on fs, allowing them to appear before,
+// between or after the positional arguments, which are returned in order.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zyaeger/gator/internal/database"
+	"github.com/zyaeger/gator/internal/output"
+)
+
+func TestParseGlobalFlags(t *testing.T) {
+	tests := []struct {
+		args      []string
+		output    output.Format
+		logFormat string
+		rest      []string
+	}{
+		{[]string{"feeds"}, output.Text, "", []string{"feeds"}},
+		{[]string{"--output", "json", "feeds"}, output.JSON, "", []string{"feeds"}},
+		{[]string{"--output=csv", "--log-format=json", "browse", "20"}, output.CSV, "json", []string{"browse", "20"}},
+		// Flags after the command belong to it.
+		{[]string{"publish", "--output", "x"}, output.Text, "", []string{"publish", "--output", "x"}},
+		{[]string{"--output", "json"}, output.JSON, "", nil},
+		{nil, output.Text, "", nil},
+	}
+	for _, tt := range tests {
+		opts, rest, err := parseGlobalFlags(tt.args)
+		if err != nil {
+			t.Errorf("parseGlobalFlags(%q): %v", tt.args, err)
+			continue
+		}
+		if opts.output != tt.output || opts.logFormat != tt.logFormat || !slices.Equal(rest, tt.rest) {
+			t.Errorf("parseGlobalFlags(%q) = %v, %q, %q, want %v, %q, %q", tt.args, opts.output, opts.logFormat, rest, tt.output, tt.logFormat, tt.rest)
+		}
+	}
+}
+
+func TestParseGlobalFlagsErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--output"},
+		{"--output", "yaml", "feeds"},
+		{"--log-format", "xml", "agg"},
+		{"--log-format=", "agg"},
+	} {
+		if _, _, err := parseGlobalFlags(args); err == nil {
+			t.Errorf("parseGlobalFlags(%q) succeeded", args)
+		}
+	}
+}
+
+func TestListingCommandsRejectArgs(t *testing.T) {
+	s := &state{}
+	handlers := map[string]func(*state, command) error{
+		"users": handlerUsers,
+		"feeds": handlerGetFeeds,
+		"following": func(s *state, cmd command) error {
+			return handlerFollowing(s, cmd, database.User{})
+		},
+	}
+	for name, handler := range handlers {
+		// The arguments are rejected before the database is used.
+		err := handler(s, command{Name: name, Args: []string{"--output", "json"}})
+		if err == nil || !strings.HasPrefix(err.Error(), "usage: "+name) {
+			t.Errorf("%s --output json: err = %v, want a usage error", name, err)
+		}
+	}
+}
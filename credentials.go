@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/zyaeger/gator/internal/config"
+	"github.com/zyaeger/gator/internal/database"
+	"github.com/zyaeger/gator/internal/secrets"
+)
+
+const secretKeyEnv = "GATOR_SECRET_KEY"
+
+var errNoSecretKey = fmt.Errorf("no secret key configured: set %s or secret_key in the config to a key from `openssl rand -base64 32`", secretKeyEnv)
+
+// feedCredentials are sent when fetching a private feed. They are stored
+// encrypted in feeds.credentials and never printed.
+type feedCredentials struct {
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+func (c feedCredentials) empty() bool {
+	return c.Username == "" && c.Password == "" && len(c.Headers) == 0
+}
+
+func (c feedCredentials) header() http.Header {
+	header := http.Header{}
+	if c.Username != "" || c.Password != "" {
+		req := http.Request{Header: header}
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	for name, value := range c.Headers {
+		header.Set(name, value)
+	}
+	return header
+}
+
+// loadSecretBox builds the box used for feed credentials from the
+// environment or, failing that, the config. It returns nil when neither
+// holds a key.
+func loadSecretBox(cfg config.Config) (*secrets.Box, error) {
+	encoded := os.Getenv(secretKeyEnv)
+	if encoded == "" {
+		encoded = cfg.SecretKey
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := secrets.ParseKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return secrets.NewBox(key)
+}
+
+func (s *state) sealCredentials(creds feedCredentials) ([]byte, error) {
+	if creds.empty() {
+		return nil, nil
+	}
+	if s.secrets == nil {
+		return nil, errNoSecretKey
+	}
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return nil, err
+	}
+	return s.secrets.Seal(data)
+}
+
+// feedHeader returns the decrypted credentials of feed as request headers.
+func (s *state) feedHeader(feed database.Feed) (http.Header, error) {
+	if len(feed.Credentials) == 0 {
+		return nil, nil
+	}
+	creds, err := s.openCredentials(feed)
+	if err != nil {
+		return nil, err
+	}
+	return creds.header(), nil
+}
+
+// openCredentials decrypts the credentials of feed, which are empty when
+// it has none.
+func (s *state) openCredentials(feed database.Feed) (feedCredentials, error) {
+	creds := feedCredentials{}
+	if len(feed.Credentials) == 0 {
+		return creds, nil
+	}
+	if s.secrets == nil {
+		return creds, errNoSecretKey
+	}
+	data, err := s.secrets.Open(feed.Credentials)
+	if err != nil {
+		return creds, err
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return creds, fmt.Errorf("couldn't read feed credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// equal reports whether c and other send the same credentials.
+func (c feedCredentials) equal(other feedCredentials) bool {
+	return c.Username == other.Username && c.Password == other.Password && maps.Equal(c.Headers, other.Headers)
+}
+
+// parseBasicAuth splits a --basic-auth value of the form user:pass.
+func parseBasicAuth(value string) (string, string, error) {
+	user, pass, ok := strings.Cut(value, ":")
+	if !ok || user == "" {
+		return "", "", errors.New("--basic-auth expects user:pass")
+	}
+	return user, pass, nil
+}
+
+// parseHeader splits a --header value of the form "Name: value".
+func parseHeader(value string) (string, string, error) {
+	name, val, ok := strings.Cut(value, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("--header expects \"Name: value\", got %q", value)
+	}
+	return http.CanonicalHeaderKey(name), strings.TrimSpace(val), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/config"
+	"github.com/zyaeger/gator/internal/database"
+)
+
+// newTestState returns a state backed by the database GATOR_TEST_DB_URL
+// names, skipping the test when it isn't set. The database is wiped and
+// rebuilt from sql/schema, so it must be one that is only used for tests.
+func newTestState(t *testing.T) *state {
+	t.Helper()
+	dbURL := os.Getenv("GATOR_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("GATOR_TEST_DB_URL is not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+		t.Fatalf("couldn't reset database: %v", err)
+	}
+	migrations, err := filepath.Glob("sql/schema/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range migrations {
+		data, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(string(data), "-- +goose Down")
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("%s: %v", migration, err)
+		}
+	}
+
+	return &state{
+		db:      database.New(db),
+		sqlDB:   db,
+		cfg:     &config.Config{},
+		fetcher: newTestFetcher(t, 0),
+	}
+}
+
+func createTestUser(t *testing.T, s *state, name string) database.User {
+	t.Helper()
+	user, err := s.db.CreateUser(context.Background(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Name:      name,
+	})
+	if err != nil {
+		t.Fatalf("couldn't create user: %v", err)
+	}
+	return user
+}
+
+// createTestFeed adds a feed at url that user owns and follows.
+func createTestFeed(t *testing.T, s *state, user database.User, url string) database.Feed {
+	t.Helper()
+	feed, _, err := addFeed(context.Background(), s, user, url, url, feedCredentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+)
+
+// enclosure is a media file attached to a feed item, from either an RSS
+// <enclosure> or a Media RSS <media:content> element.
+type enclosure struct {
+	URL      string
+	Type     string
+	Length   int64
+	Duration int
+}
+
+// MediaFiles returns the item's enclosures, de-duplicated by URL. The
+// itunes:duration of the item applies to its RSS enclosures.
+func (item RSSItem) MediaFiles() []enclosure {
+	var files []enclosure
+	seen := map[string]bool{}
+	add := func(e enclosure) {
+		e.URL = strings.TrimSpace(e.URL)
+		if e.URL == "" || seen[e.URL] {
+			return
+		}
+		seen[e.URL] = true
+		files = append(files, e)
+	}
+
+	duration := parseMediaDuration(item.ItunesDuration)
+	for _, e := range item.Enclosures {
+		add(enclosure{URL: e.URL, Type: e.Type, Length: parseLength(e.Length), Duration: duration})
+	}
+
+	contents := item.MediaContent
+	for _, group := range item.MediaGroups {
+		contents = append(contents, group.Content...)
+	}
+	for _, c := range contents {
+		add(enclosure{URL: c.URL, Type: c.Type, Length: parseLength(c.FileSize), Duration: parseMediaDuration(c.Duration)})
+	}
+	return files
+}
+
+func parseLength(s string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// parseMediaDuration reads durations written as seconds, MM:SS or HH:MM:SS
+// and returns whole seconds, or 0 when unknown.
+func parseMediaDuration(s string) int {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	seconds := 0.0
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return int(seconds)
+}
+
+func storeEnclosures(ctx context.Context, db *database.Queries, postID uuid.UUID, files []enclosure) error {
+	for _, file := range files {
+		err := db.CreateEnclosure(ctx, database.CreateEnclosureParams{
+			ID:              uuid.New(),
+			CreatedAt:       time.Now().UTC(),
+			UpdatedAt:       time.Now().UTC(),
+			PostID:          postID,
+			Url:             file.URL,
+			MimeType:        optionalString(file.Type),
+			Length:          sql.NullInt64{Int64: file.Length, Valid: file.Length > 0},
+			DurationSeconds: sql.NullInt32{Int32: int32(file.Duration), Valid: file.Duration > 0},
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't create enclosure: %w", err)
+		}
+	}
+	return nil
+}
+
+func describeEnclosure(e database.Enclosure) string {
+	var details []string
+	if e.MimeType.Valid {
+		details = append(details, e.MimeType.String)
+	}
+	if e.Length.Valid {
+		details = append(details, formatBytes(e.Length.Int64))
+	}
+	if e.DurationSeconds.Valid {
+		details = append(details, formatSeconds(int(e.DurationSeconds.Int32)))
+	}
+	if len(details) == 0 {
+		return e.Url
+	}
+	return fmt.Sprintf("%s (%s)", e.Url, strings.Join(details, ", "))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func formatSeconds(seconds int) string {
+	h, m, s := seconds/3600, seconds/60%60, seconds%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+func handlerDownload(s *state, cmd command) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	dir := fs.String("dir", ".", "directory to save the files in")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil || len(args) != 1 {
+		return fmt.Errorf("usage: %s <post-id> [--dir DIR]", cmd.Name)
+	}
+
+	postID, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid post id: %w", err)
+	}
+	files, err := s.db.GetEnclosuresForPost(context.Background(), postID)
+	if err != nil {
+		return fmt.Errorf("couldn't get enclosures: %w", err)
+	}
+	if len(files) == 0 {
+		return errors.New("post has no enclosures")
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return fmt.Errorf("couldn't create directory: %w", err)
+	}
+
+	for _, file := range files {
+		dest := filepath.Join(*dir, enclosureFileName(file))
+		written, err := downloadFile(context.Background(), s.fetcher, file.Url, dest)
+		if err != nil {
+			return fmt.Errorf("couldn't download %s: %w", file.Url, err)
+		}
+		fmt.Printf("Saved %s (%s)\n", dest, formatBytes(written))
+	}
+	return nil
+}
+
+// enclosureFileName derives a local file name from the enclosure URL,
+// falling back to the enclosure id and an extension for its MIME type.
+// The id is added to names taken from the URL too, since every episode of
+// some podcasts is called "episode.mp3".
+func enclosureFileName(e database.Enclosure) string {
+	if u, err := url.Parse(e.Url); err == nil {
+		name := path.Base(u.Path)
+		if name != "/" && name != "." && name != ".." && name != "" && !strings.ContainsAny(name, `\:`) {
+			ext := path.Ext(name)
+			return strings.TrimSuffix(name, ext) + "-" + e.ID.String() + ext
+		}
+	}
+
+	name := e.ID.String()
+	if e.MimeType.Valid {
+		if exts, err := mime.ExtensionsByType(e.MimeType.String); err == nil && len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	return name
+}
+
+// downloadFile streams rawURL into dest. Data is written to dest.part
+// first, so an interrupted download is resumed with a Range request the
+// next time. It returns the size of the finished file.
+func downloadFile(ctx context.Context, f *fetcher, rawURL, dest string) (int64, error) {
+	if info, err := os.Stat(dest); err == nil {
+		fmt.Printf("%s already downloaded\n", dest)
+		return info.Size(), nil
+	}
+
+	partial := dest + ".part"
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := f.newRequest(ctx, rawURL)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := f.download(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, _, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			// Appending anything but the bytes we asked for would corrupt
+			// the file.
+			return restartDownload(ctx, f, rawURL, dest, resp)
+		}
+		flags |= os.O_APPEND
+		fmt.Printf("Resuming %s at %s\n", dest, formatBytes(offset))
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+		offset = 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file already holds the whole enclosure, unless it
+		// differs from the size the server reports.
+		if _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); !ok || total != offset {
+			return restartDownload(ctx, f, rawURL, dest, resp)
+		}
+		return offset, os.Rename(partial, dest)
+	default:
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	out, err := os.OpenFile(partial, flags, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(out, resp.Body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return offset + written, os.Rename(partial, dest)
+}
+
+// restartDownload throws away the partial file of dest and downloads it
+// again from the start, after the server answered a resume with something
+// that doesn't fit it.
+func restartDownload(ctx context.Context, f *fetcher, rawURL, dest string, resp *http.Response) (int64, error) {
+	resp.Body.Close()
+	fmt.Printf("Can't resume %s, starting over\n", dest)
+	if err := os.Remove(dest + ".part"); err != nil {
+		return 0, err
+	}
+	return downloadFile(ctx, f, rawURL, dest)
+}
+
+// parseContentRange returns the first byte and the complete length given
+// by a Content-Range header, either "bytes first-last/length" or
+// "bytes */length". first is -1 in the latter form, and length is -1 when
+// the server sent "*".
+func parseContentRange(value string) (first, length int64, ok bool) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rng, size, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+
+	length = -1
+	if size != "*" {
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		length = n
+	}
+	if rng == "*" {
+		return -1, length, true
+	}
+	firstStr, lastStr, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, false
+	}
+	first, err := strconv.ParseInt(firstStr, 10, 64)
+	if err != nil || first < 0 {
+		return 0, 0, false
+	}
+	last, err := strconv.ParseInt(lastStr, 10, 64)
+	if err != nil || last < first || (length >= 0 && last >= length) {
+		return 0, 0, false
+	}
+	return first, length, true
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+)
+
+const testMedia = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+func TestEnclosureFileName(t *testing.T) {
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	tests := []struct {
+		url  string
+		mime string
+		want string
+	}{
+		{"https://example.com/podcast/episode.mp3", "", "episode-" + id.String() + ".mp3"},
+		{"https://example.com/a/..", "audio/mpeg", id.String() + ".mp3"},
+		{"https://example.com/", "", id.String()},
+		{`https://example.com/C:\evil.mp3`, "", id.String()},
+	}
+	for _, tt := range tests {
+		e := database.Enclosure{ID: id, Url: tt.url, MimeType: sql.NullString{String: tt.mime, Valid: tt.mime != ""}}
+		if got := enclosureFileName(e); got != tt.want {
+			t.Errorf("enclosureFileName(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	other := database.Enclosure{ID: uuid.New(), Url: "https://other.example.com/episode.mp3"}
+	if enclosureFileName(other) == enclosureFileName(database.Enclosure{ID: id, Url: "https://example.com/episode.mp3"}) {
+		t.Error("enclosures with the same base name got the same file name")
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value         string
+		first, length int64
+		ok            bool
+	}{
+		{"bytes 10-35/36", 10, 36, true},
+		{"bytes 10-35/*", 10, -1, true},
+		{"bytes */36", -1, 36, true},
+		{"bytes 10-36/36", 0, 0, false},
+		{"bytes 20-10/36", 0, 0, false},
+		{"items 0-1/2", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		first, length, ok := parseContentRange(tt.value)
+		if first != tt.first || length != tt.length || ok != tt.ok {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v, want %d, %d, %v", tt.value, first, length, ok, tt.first, tt.length, tt.ok)
+		}
+	}
+}
+
+// mediaServer serves testMedia, answering Range requests with respond.
+func mediaServer(t *testing.T, respond func(w http.ResponseWriter, offset int)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var offset int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset); err != nil {
+			w.Write([]byte(testMedia))
+			return
+		}
+		respond(w, offset)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func downloadWithPartial(t *testing.T, srv *httptest.Server, partial string) string {
+	t.Helper()
+	dest := filepath.Join(t.TempDir(), "episode.mp3")
+	if err := os.WriteFile(dest+".part", []byte(partial), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	written, err := downloadFile(context.Background(), newTestFetcher(t, 0), srv.URL, dest)
+	if err != nil {
+		t.Fatalf("downloadFile: %v", err)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(len(data)) {
+		t.Errorf("reported %d bytes, file has %d", written, len(data))
+	}
+	return string(data)
+}
+
+func TestDownloadFileResumes(t *testing.T) {
+	srv := mediaServer(t, func(w http.ResponseWriter, offset int) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(testMedia)-1, len(testMedia)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(testMedia[offset:]))
+	})
+	if got := downloadWithPartial(t, srv, testMedia[:10]); got != testMedia {
+		t.Errorf("file = %q, want %q", got, testMedia)
+	}
+}
+
+func TestDownloadFileRestartsOnWrongRange(t *testing.T) {
+	srv := mediaServer(t, func(w http.ResponseWriter, offset int) {
+		// Ignore the requested start.
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 5-%d/%d", len(testMedia)-1, len(testMedia)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(testMedia[5:]))
+	})
+	if got := downloadWithPartial(t, srv, testMedia[:10]); got != testMedia {
+		t.Errorf("file = %q, want %q", got, testMedia)
+	}
+}
+
+func TestDownloadFileRangeNotSatisfiable(t *testing.T) {
+	srv := mediaServer(t, func(w http.ResponseWriter, offset int) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(testMedia)))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+	})
+	if got := downloadWithPartial(t, srv, testMedia); got != testMedia {
+		t.Errorf("complete partial file: got %q, want %q", got, testMedia)
+	}
+	// A partial file larger than the enclosure can't be it.
+	if got := downloadWithPartial(t, srv, testMedia+strings.Repeat("x", 10)); got != testMedia {
+		t.Errorf("oversized partial file: got %q, want %q", got, testMedia)
+	}
+}
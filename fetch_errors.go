@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPStatusError is returned when a feed responds with anything but 200.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	// RetryAfter is how long the server asked us to wait, if it did.
+	RetryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	msg := fmt.Sprintf("%s responded with %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	return msg
+}
+
+// Temporary reports whether retrying later may succeed.
+func (e *HTTPStatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout || e.StatusCode >= 500
+}
+
+// ParseError is returned when a response is not a feed we can read.
+type ParseError struct {
+	URL string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("couldn't parse feed %s: %v", e.URL, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned when a feed doesn't respond in time.
+type TimeoutError struct {
+	URL string
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out fetching %s: %v", e.URL, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// TooLargeError is returned when a response body exceeds the size limit.
+type TooLargeError struct {
+	URL   string
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("%s is larger than the %d byte limit", e.URL, e.Limit)
+}
+
+// RateLimitedError is returned without contacting a host that asked us to
+// back off, until the time it gave has passed.
+type RateLimitedError struct {
+	URL   string
+	Until time.Time
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("not fetching %s, its host asked us to wait until %s", e.URL, e.Until.Format(time.DateTime))
+}
+
+// classifyRequestError turns timeouts reported by the HTTP client into a
+// TimeoutError and returns other errors unchanged.
+func classifyRequestError(feedUrl string, err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &TimeoutError{URL: feedUrl, Err: err}
+	}
+	return err
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/zyaeger/gator/internal/config"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+const defaultFetchTimeout = 10 * time.Second
+
+// fetcher downloads feeds through a single pooled HTTP client configured
+// from the fetch section of .gatorconfig.json.
+type fetcher struct {
+	client *http.Client
+	// downloads shares the connection pool but has no overall timeout,
+	// which is meant for feeds rather than large media files.
+	downloads *http.Client
+	// webhooks doesn't follow redirects, which would carry signed
+	// payloads to wherever a receiver points.
+	webhooks  *http.Client
+	userAgent string
+	maxBytes  int64
+	// headers holds extra request headers keyed by feed URL.
+	headers map[string]map[string]string
+	limiter *hostLimiter
+	// robots is nil unless robots.txt is respected.
+	robots *robotsChecker
+}
+
+// fetchResult is a fetched feed along with what was noticed while
+// fetching and parsing it.
+type fetchResult struct {
+	Feed *RSSFeed
+	// ParseWarnings counts the problems the lenient parser recovered from.
+	ParseWarnings int
+	// StatusCode is the status of the final response, if one was received.
+	StatusCode int
+	// MovedTo is the final URL when every redirect followed was permanent.
+	MovedTo string
+}
+
+func newFetcher(cfg config.FetchConfig) (*fetcher, error) {
+	timeout := defaultFetchTimeout
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid fetch timeout %q", cfg.Timeout)
+		}
+		timeout = d
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 4
+	transport.DisableCompression = true
+
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fetch proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = "gator/" + version
+		if cfg.ContactURL != "" {
+			userAgent += " (+" + cfg.ContactURL + ")"
+		}
+	}
+
+	rate, burst, concurrency := cfg.HostLimits()
+
+	f := &fetcher{
+		client:    &http.Client{Timeout: timeout, Transport: transport, CheckRedirect: checkRedirect},
+		downloads: &http.Client{Transport: transport, CheckRedirect: checkRedirect},
+		webhooks: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		userAgent: userAgent,
+		maxBytes:  cfg.BodyLimit(),
+		headers:   cfg.Headers,
+		limiter:   newHostLimiter(rate, burst, concurrency),
+	}
+	if cfg.RespectRobots {
+		f.robots = newRobotsChecker(f)
+	}
+	return f, nil
+}
+
+// newRequest builds a GET request carrying the User-Agent and any headers
+// configured for rawURL.
+func (f *fetcher) newRequest(ctx context.Context, rawURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	var names []string
+	for name, value := range f.headers[rawURL] {
+		req.Header.Set(name, value)
+		names = append(names, name)
+	}
+	return withPrivateHeaders(req, names), nil
+}
+
+// privateHeadersKey is the context key of the header names checkRedirect
+// drops when a redirect leaves the host of a request.
+type privateHeadersKey struct{}
+
+// withPrivateHeaders marks the named headers of req, which come from the
+// configuration or credentials of a feed, as not to be sent to other hosts.
+func withPrivateHeaders(req *http.Request, names []string) *http.Request {
+	if len(names) == 0 {
+		return req
+	}
+	private, _ := req.Context().Value(privateHeadersKey{}).([]string)
+	private = append(slices.Clone(private), names...)
+	return req.WithContext(context.WithValue(req.Context(), privateHeadersKey{}, private))
+}
+
+// checkRedirect follows up to 10 redirects like the default policy. Once
+// they leave the host of the original request it drops the headers marked
+// by withPrivateHeaders, such as API keys, the way the http package already
+// drops Authorization and Cookie.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	private, _ := req.Context().Value(privateHeadersKey{}).([]string)
+	host := via[0].URL.Host
+	left := !strings.EqualFold(req.URL.Host, host)
+	for _, r := range via[1:] {
+		left = left || !strings.EqualFold(r.URL.Host, host)
+	}
+	if left {
+		for _, name := range private {
+			req.Header.Del(name)
+		}
+	}
+	return nil
+}
+
+// fetch downloads and parses feedUrl, sending header on top of the
+// configured ones. At most the configured number of bytes of the decoded
+// body are read; anything larger fails with a TooLargeError. Requests are
+// spaced out per host, and a 429 or 503 keeps the host's other feeds from
+// being fetched until its Retry-After has passed. When robots.txt is
+// respected, disallowed URLs fail with a RobotsDisallowedError.
+func (f *fetcher) fetch(ctx context.Context, feedUrl string, header http.Header) (*fetchResult, error) {
+	req, err := f.newRequest(ctx, feedUrl)
+	if err != nil {
+		return &fetchResult{}, err
+	}
+	var names []string
+	for name, values := range header {
+		req.Header[name] = values
+		names = append(names, name)
+	}
+	req = withPrivateHeaders(req, names)
+	// Setting Accept-Encoding ourselves turns off the transport's transparent
+	// gzip support, so every encoding is decoded in decodeBody.
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+
+	if f.robots != nil {
+		if err := f.robots.check(ctx, req.URL, feedUrl); err != nil {
+			return &fetchResult{}, err
+		}
+	}
+
+	release, err := f.limiter.acquire(ctx, req.URL.Host, feedUrl)
+	if err != nil {
+		return &fetchResult{}, err
+	}
+	defer release()
+
+	start := time.Now()
+	defer func() {
+		fetchDuration.Observe(time.Since(start).Seconds())
+	}()
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return &fetchResult{}, classifyRequestError(feedUrl, err)
+	}
+	defer resp.Body.Close()
+	resp.Body = io.NopCloser(countingReader{resp.Body})
+	result := &fetchResult{
+		StatusCode: resp.StatusCode,
+		MovedTo:    permanentRedirect(resp),
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests && retryAfter == 0:
+			f.limiter.backOff(req.URL.Host, time.Now().Add(defaultBackoff))
+		case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusServiceUnavailable:
+			f.limiter.backOff(req.URL.Host, time.Now().Add(retryAfter))
+		}
+		return result, &HTTPStatusError{
+			URL:        feedUrl,
+			StatusCode: resp.StatusCode,
+			RetryAfter: retryAfter,
+		}
+	}
+
+	if resp.ContentLength > f.maxBytes && resp.Header.Get("Content-Encoding") == "" {
+		return result, &TooLargeError{URL: feedUrl, Limit: f.maxBytes}
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		return result, err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, f.maxBytes+1))
+	if err != nil {
+		return result, classifyRequestError(feedUrl, err)
+	}
+	if int64(len(data)) > f.maxBytes {
+		return result, &TooLargeError{URL: feedUrl, Limit: f.maxBytes}
+	}
+
+	result.Feed, result.ParseWarnings, err = parseFeed(data, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return result, &ParseError{URL: feedUrl, Err: err}
+	}
+	return result, nil
+}
+
+// permanentRedirect returns the URL resp was finally served from when it
+// was reached only through 301 and 308 redirects. A single temporary hop
+// means the original URL is still the one to keep.
+func permanentRedirect(resp *http.Response) string {
+	if resp.Request == nil || resp.Request.Response == nil {
+		return ""
+	}
+	for r := resp.Request.Response; r != nil; r = r.Request.Response {
+		if r.StatusCode != http.StatusMovedPermanently && r.StatusCode != http.StatusPermanentRedirect {
+			return ""
+		}
+	}
+	return resp.Request.URL.String()
+}
+
+// download sends req without the fetch timeout.
+func (f *fetcher) download(req *http.Request) (*http.Response, error) {
+	return f.downloads.Do(req)
+}
+
+// decodeBody undoes the Content-Encoding of a response. The size limit is
+// applied to the decoded stream so compressed bombs are caught too.
+func decodeBody(resp *http.Response) (io.Reader, error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	case "br":
+		return brotli.NewReader(resp.Body), nil
+	case "deflate":
+		// "deflate" should be zlib-wrapped, but some servers send raw
+		// DEFLATE data, so look at the header before choosing.
+		br := bufio.NewReader(resp.Body)
+		header, err := br.Peek(2)
+		if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+	return nil, errors.New("unsupported Content-Encoding " + encoding)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/zyaeger/gator/internal/config"
+)
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel><title>Test feed</title><link>https://example.com/</link>
+<item><title>First post</title><link>https://example.com/1</link></item>
+</channel></rss>`
+
+func newTestFetcher(t *testing.T, maxBytes int64) *fetcher {
+	t.Helper()
+	f, err := newFetcher(config.FetchConfig{MaxBodyBytes: maxBytes, Timeout: "5s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		t.Fatalf("unknown encoding %q", encoding)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFetchDecodesContentEncodings(t *testing.T) {
+	tests := []struct {
+		encoding string
+		header   string
+	}{
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"raw deflate", "deflate"},
+		{"br", "br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			body := compress(t, tt.encoding, []byte(testFeed))
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Accept-Encoding"); got != "gzip, deflate, br" {
+					t.Errorf("Accept-Encoding = %q", got)
+				}
+				w.Header().Set("Content-Encoding", tt.header)
+				w.Write(body)
+			}))
+			defer srv.Close()
+
+			result, err := newTestFetcher(t, 0).fetch(context.Background(), srv.URL, nil)
+			if err != nil {
+				t.Fatalf("fetch: %v", err)
+			}
+			if got := result.Feed.Channel.Title; got != "Test feed" {
+				t.Errorf("title = %q, want %q", got, "Test feed")
+			}
+			if len(result.Feed.Channel.Item) != 1 {
+				t.Errorf("got %d items, want 1", len(result.Feed.Channel.Item))
+			}
+		})
+	}
+}
+
+func TestFetchRejectsOversizedBody(t *testing.T) {
+	const limit = 1024
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Flushing first makes the response chunked, with no Content-Length
+		// to reject it by.
+		w.(http.Flusher).Flush()
+		w.Write([]byte(testFeed))
+		w.Write(bytes.Repeat([]byte(" "), 2*limit))
+	}))
+	defer srv.Close()
+
+	_, err := newTestFetcher(t, limit).fetch(context.Background(), srv.URL, nil)
+	var tooLarge *TooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("err = %v, want TooLargeError", err)
+	}
+	if tooLarge.Limit != limit {
+		t.Errorf("limit = %d, want %d", tooLarge.Limit, limit)
+	}
+}
+
+func TestFetchRejectsContentLengthBeforeReading(t *testing.T) {
+	const limit = 1024
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1048576")
+		w.Write([]byte("<rss>"))
+		w.(http.Flusher).Flush()
+		// Never send the rest: reading the body would hang until the
+		// client times out instead of failing with TooLargeError.
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	_, err := newTestFetcher(t, limit).fetch(context.Background(), srv.URL, nil)
+	var tooLarge *TooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("err = %v, want TooLargeError", err)
+	}
+}
+
+func TestFetchRejectsGzipBomb(t *testing.T) {
+	const limit = 64 << 10
+	bomb := compress(t, "gzip", append([]byte(testFeed), make([]byte, 16<<20)...))
+	if len(bomb) >= limit {
+		t.Fatalf("compressed bomb is %d bytes, want less than the limit", len(bomb))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(bomb)
+	}))
+	defer srv.Close()
+
+	_, err := newTestFetcher(t, limit).fetch(context.Background(), srv.URL, nil)
+	var tooLarge *TooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("err = %v, want TooLargeError", err)
+	}
+}
+
+func TestDecodeBodyUnsupportedEncoding(t *testing.T) {
+	resp := &http.Response{
+		Header: http.Header{"Content-Encoding": {"zstd"}},
+		Body:   io.NopCloser(strings.NewReader("")),
+	}
+	if _, err := decodeBody(resp); err == nil {
+		t.Fatal("expected an error for zstd")
+	}
+}
+
+func TestFetchDropsFeedHeadersOnCrossHostRedirect(t *testing.T) {
+	received := make(chan http.Header, 1)
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		w.Write([]byte(testFeed))
+	}))
+	defer elsewhere.Close()
+
+	for _, tt := range []struct {
+		name        string
+		target      string
+		wantPrivate bool
+	}{
+		{"same host", "/moved", true},
+		{"other host", elsewhere.URL + "/feed.xml", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/moved" {
+					received <- r.Header.Clone()
+					w.Write([]byte(testFeed))
+					return
+				}
+				http.Redirect(w, r, tt.target, http.StatusFound)
+			}))
+			defer origin.Close()
+
+			feedURL := origin.URL + "/feed.xml"
+			f, err := newFetcher(config.FetchConfig{
+				Timeout: "5s",
+				Headers: map[string]map[string]string{feedURL: {"X-Api-Key": "configured"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			creds := http.Header{"X-Token": {"from-addfeed"}, "Authorization": {"Basic dXNlcjpwYXNz"}}
+			if _, err := f.fetch(context.Background(), feedURL, creds); err != nil {
+				t.Fatalf("fetch: %v", err)
+			}
+
+			header := <-received
+			for _, name := range []string{"X-Api-Key", "X-Token", "Authorization"} {
+				if got := header.Get(name) != ""; got != tt.wantPrivate {
+					t.Errorf("%s sent: %v, want %v", name, got, tt.wantPrivate)
+				}
+			}
+			if header.Get("User-Agent") == "" {
+				t.Error("User-Agent was dropped")
+			}
+		})
+	}
+}
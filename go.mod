@@ -4,4 +4,15 @@ go 1.25.0
 
 require github.com/google/uuid v1.6.0
 
-require github.com/lib/pq v1.10.9
+require (
+	github.com/andybalholm/brotli v1.2.0
+	github.com/lib/pq v1.10.9
+	golang.org/x/crypto v0.54.0
+	golang.org/x/net v0.57.0
+	golang.org/x/term v0.45.0
+)
+
+require (
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+)
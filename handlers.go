@@ -4,13 +4,21 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/zyaeger/gator/internal/database"
+	"github.com/zyaeger/gator/internal/output"
+	"github.com/zyaeger/gator/internal/render"
+	"github.com/zyaeger/gator/internal/sanitize"
+	"golang.org/x/term"
 )
 
 func handlerLogin(s *state, cmd command) error {
@@ -24,6 +32,9 @@ func handlerLogin(s *state, cmd command) error {
 		fmt.Printf("cannot find user %s in DB\n", username)
 		return err
 	}
+	if err := checkPassword(user); err != nil {
+		return err
+	}
 
 	err = s.cfg.SetUser(user.Name)
 	if err != nil {
@@ -40,11 +51,26 @@ func handlerRegister(s *state, cmd command) error {
 	}
 	ctx := context.Background()
 	name := cmd.Args[0]
+
+	// Scripts that register users without a terminal keep working as
+	// before; they can set a password later with passwd.
+	hashed := sql.NullString{}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		password, err := readNewPassword("Password (leave empty for none): ", true)
+		if err != nil {
+			return err
+		}
+		if hashed, err = hashPassword(password); err != nil {
+			return err
+		}
+	}
+
 	userParams := database.CreateUserParams{
-		ID:        uuid.New(),
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
-		Name:      name,
+		ID:             uuid.New(),
+		CreatedAt:      time.Now().UTC(),
+		UpdatedAt:      time.Now().UTC(),
+		Name:           name,
+		HashedPassword: hashed,
 	}
 	user, err := s.db.CreateUser(ctx, userParams)
 	if err != nil {
@@ -75,8 +101,8 @@ func handlerReset(s *state, cmd command) error {
 }
 
 func handlerUsers(s *state, cmd command) error {
-	if len(cmd.Args) != 0 {
-		return errors.New("zero arguments expected")
+	if err := noArgs(cmd); err != nil {
+		return err
 	}
 
 	users, err := s.db.GetUsers(context.Background())
@@ -84,96 +110,248 @@ func handlerUsers(s *state, cmd command) error {
 		return fmt.Errorf("couldn't retrieve users: %w", err)
 	}
 
+	table := output.NewTable("id", "name", "created_at", "current")
 	for _, user := range users {
-		if user.Name == s.cfg.CurrentUserName {
-			fmt.Printf("* %s (current)\n", user.Name)
-			continue
-		}
-		fmt.Println("*", user.Name)
+		table.Append(user.ID, user.Name, user.CreatedAt, user.Name == s.cfg.CurrentUserName)
 	}
-	return nil
+
+	return s.render(table, func() {
+		for _, user := range users {
+			if user.Name == s.cfg.CurrentUserName {
+				fmt.Printf("* %s (current)\n", user.Name)
+				continue
+			}
+			fmt.Println("*", user.Name)
+		}
+	})
 }
 
 func handlerAgg(s *state, cmd command) error {
-	if len(cmd.Args) != 1 {
-		return fmt.Errorf("usage: %s <time_between_reqs>", cmd.Name)
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	listen := fs.String("listen", "", "address to serve /metrics, /healthz and /readyz on")
+	readyIntervals := fs.Int("ready-intervals", 3, "intervals without a successful scrape before /readyz fails")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil || len(args) != 1 || *readyIntervals < 1 {
+		return fmt.Errorf("usage: %s <time_between_reqs> [--listen ADDR] [--ready-intervals N]", cmd.Name)
 	}
 
-	timeBetweenRequests, err := time.ParseDuration(cmd.Args[0])
+	timeBetweenRequests, err := time.ParseDuration(args[0])
 	if err != nil {
 		return fmt.Errorf("couldn't convert to time.Duration: %w", err)
 	}
 
-	fmt.Printf("Collecting feeds every %s...\n", timeBetweenRequests)
+	health := newAggHealth(s, timeBetweenRequests, *readyIntervals)
+	if *listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", s.metricsHandler())
+		health.register(mux)
+		server := &http.Server{
+			Addr:              *listen,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			slog.Error("couldn't serve metrics", "addr", *listen, "error", server.ListenAndServe())
+			os.Exit(1)
+		}()
+		slog.Info("serving metrics and health checks", "addr", *listen)
+	}
+
+	go s.runWebhookWorker(context.Background())
+
+	slog.Info("collecting feeds", "interval", timeBetweenRequests)
 	ticker := time.NewTicker(timeBetweenRequests)
 	for ; ; <-ticker.C {
-		scrapeFeeds(s)
+		if scrapeFeeds(s) {
+			health.scraped()
+		}
 	}
 }
 
 func handlerAddFeed(s *state, cmd command, user database.User) error {
-	if len(cmd.Args) != 2 {
-		return fmt.Errorf("usage: %s <name> <url>", cmd.Name)
+	creds := feedCredentials{}
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.Func("basic-auth", "user:pass sent with HTTP basic auth", func(value string) error {
+		var err error
+		creds.Username, creds.Password, err = parseBasicAuth(value)
+		return err
+	})
+	fs.Func("header", "\"Name: value\" request header, may be repeated", func(value string) error {
+		name, val, err := parseHeader(value)
+		if err != nil {
+			return err
+		}
+		if creds.Headers == nil {
+			creds.Headers = map[string]string{}
+		}
+		creds.Headers[name] = val
+		return nil
+	})
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil {
+		return fmt.Errorf("%w\nusage: %s <name> <url> [--basic-auth user:pass] [--header \"Name: value\"]", err, cmd.Name)
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s <name> <url> [--basic-auth user:pass] [--header \"Name: value\"]", cmd.Name)
 	}
 
-	name := cmd.Args[0]
-	url := cmd.Args[1]
-	feedParams := database.CreateFeedParams{
-		ID:        uuid.New(),
-		Name:      name,
-		Url:       url,
-		UserID:    user.ID,
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
+	feed, feedFollow, err := addFeed(context.Background(), s, user, args[0], args[1], creds)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Feed created successfully!")
+	printFeed(feed, user)
+	printFeedFollow(feedFollow.UserName, feedFollow.FeedName)
+	fmt.Println()
+	fmt.Println("=====================================")
+
+	return nil
+}
+
+// addFeed creates a feed owned by user, who follows it right away.
+func addFeed(ctx context.Context, s *state, user database.User, name, url string, creds feedCredentials) (database.Feed, database.CreateFeedFollowRow, error) {
+	sealed, err := s.sealCredentials(creds)
+	if err != nil {
+		return database.Feed{}, database.CreateFeedFollowRow{}, fmt.Errorf("couldn't store credentials: %w", err)
 	}
 
-	feed, err := s.db.CreateFeed(context.Background(), feedParams)
+	feedParams := database.CreateFeedParams{
+		ID:          uuid.New(),
+		Name:        name,
+		Url:         url,
+		UserID:      user.ID,
+		CreatedAt:   time.Now().UTC(),
+		UpdatedAt:   time.Now().UTC(),
+		Credentials: sealed,
+	}
+	feed, err := s.db.CreateFeed(ctx, feedParams)
 	if err != nil {
-		return fmt.Errorf("couldn't create feed: %w", err)
+		return feed, database.CreateFeedFollowRow{}, fmt.Errorf("couldn't create feed: %w", err)
 	}
 
-	feedFollowParam := database.CreateFeedFollowParams{
+	feedFollow, err := followFeed(ctx, s, user, feed)
+	return feed, feedFollow, err
+}
+
+func followFeed(ctx context.Context, s *state, user database.User, feed database.Feed) (database.CreateFeedFollowRow, error) {
+	feedFollowParams := database.CreateFeedFollowParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
 		UserID:    user.ID,
 		FeedID:    feed.ID,
 	}
-	feedFollow, err := s.db.CreateFeedFollow(context.Background(), feedFollowParam)
+	feedFollow, err := s.db.CreateFeedFollow(ctx, feedFollowParams)
 	if err != nil {
-		return fmt.Errorf("couldn't create feed follow: %w", err)
+		return feedFollow, fmt.Errorf("couldn't create feed follow: %w", err)
 	}
-
-	fmt.Println("Feed created successfully!")
-	printFeed(feed, user)
-	printFeedFollow(feedFollow.UserName, feedFollow.FeedName)
-	fmt.Println()
-	fmt.Println("=====================================")
-
-	return nil
+	return feedFollow, nil
 }
 
 func handlerGetFeeds(s *state, cmd command) error {
+	if err := noArgs(cmd); err != nil {
+		return err
+	}
 	feeds, err := s.db.GetFeeds(context.Background())
 	if err != nil {
 		return fmt.Errorf("couldn't fetch feeds: %w", err)
 	}
 
-	if len(feeds) == 0 {
-		fmt.Println("No feeds found.")
-		return nil
-	}
-
-	fmt.Printf("Found %d feeds:\n", len(feeds))
-	for _, feed := range feeds {
+	users := make([]database.User, len(feeds))
+	statuses := make([]string, len(feeds))
+	table := output.NewTable("id", "name", "url", "user_id", "user_name", "created_at", "updated_at", "last_fetched_at", "authenticated", "status")
+	for i, feed := range feeds {
 		user, err := s.db.GetUserById(context.Background(), feed.UserID)
 		if err != nil {
 			return fmt.Errorf("couldn't get user: %w", err)
 		}
-		printFeed(feed, user)
-		fmt.Println("=====================================")
+		users[i] = user
+		fetches, err := s.db.GetFeedFetches(context.Background(), database.GetFeedFetchesParams{
+			FeedID: feed.ID,
+			Limit:  1,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't get fetch history: %w", err)
+		}
+		if len(fetches) > 0 {
+			statuses[i] = feedStatus(fetches[0])
+		}
+		table.Append(feed.ID, feed.Name, feed.Url, user.ID, user.Name, feed.CreatedAt, feed.UpdatedAt, nullTime(feed.LastFetchedAt), len(feed.Credentials) > 0, statuses[i])
 	}
-	return nil
+
+	return s.render(table, func() {
+		if len(feeds) == 0 {
+			fmt.Println("No feeds found.")
+			return
+		}
+
+		fmt.Printf("Found %d feeds:\n", len(feeds))
+		for i, feed := range feeds {
+			printFeed(feed, users[i])
+			if statuses[i] != "" {
+				fmt.Printf("* Status:        %s\n", statuses[i])
+			}
+			fmt.Println("=====================================")
+		}
+	})
+}
+
+func handlerHistory(s *state, cmd command) error {
+	if len(cmd.Args) < 1 || len(cmd.Args) > 2 {
+		return fmt.Errorf("usage: %s <feed_url> [limit]", cmd.Name)
+	}
+	limit := 10
+	if len(cmd.Args) == 2 {
+		n, err := strconv.Atoi(cmd.Args[1])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid limit %q", cmd.Args[1])
+		}
+		limit = n
+	}
+
+	feed, err := s.db.GetFeedByUrl(context.Background(), cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't fetch feed: %w", err)
+	}
+	fetches, err := s.db.GetFeedFetches(context.Background(), database.GetFeedFetchesParams{
+		FeedID: feed.ID,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't fetch history: %w", err)
+	}
+
+	table := output.NewTable("fetched_at", "status", "http_status", "posts_found", "posts_inserted", "error", "message")
+	for _, fetch := range fetches {
+		var httpStatus any
+		if fetch.HttpStatus.Valid {
+			httpStatus = fetch.HttpStatus.Int32
+		}
+		table.Append(fetch.CreatedAt, fetch.Status, httpStatus, fetch.PostsFound, fetch.PostsInserted, nullString(fetch.Error), nullString(fetch.Message))
+	}
+
+	return s.render(table, func() {
+		if len(fetches) == 0 {
+			fmt.Printf("%s has not been collected yet.\n", feed.Name)
+			return
+		}
+		fmt.Printf("Last %d collections of %s:\n", len(fetches), feed.Name)
+		for _, fetch := range fetches {
+			line := fmt.Sprintf("%s  %-5s", fetch.CreatedAt.Format(time.DateTime), fetch.Status)
+			if fetch.HttpStatus.Valid {
+				line += fmt.Sprintf("  HTTP %d", fetch.HttpStatus.Int32)
+			}
+			line += fmt.Sprintf("  %d found, %d new", fetch.PostsFound, fetch.PostsInserted)
+			fmt.Println(line)
+			if fetch.Error.Valid {
+				fmt.Println("    error:", fetch.Error.String)
+			}
+			if fetch.Message.Valid {
+				fmt.Println("    " + fetch.Message.String)
+			}
+		}
+	})
 }
 
 func handlerFollow(s *state, cmd command, user database.User) error {
@@ -186,16 +364,9 @@ func handlerFollow(s *state, cmd command, user database.User) error {
 		return fmt.Errorf("couldn't fetch feed: %w", err)
 	}
 
-	feedFollowParams := database.CreateFeedFollowParams{
-		ID:        uuid.New(),
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
-		UserID:    user.ID,
-		FeedID:    feed.ID,
-	}
-	feedFollow, err := s.db.CreateFeedFollow(context.Background(), feedFollowParams)
+	feedFollow, err := followFeed(context.Background(), s, user, feed)
 	if err != nil {
-		return fmt.Errorf("couldn't create feed follow: %w", err)
+		return err
 	}
 
 	fmt.Println("Feed Follow created successfully!")
@@ -206,21 +377,30 @@ func handlerFollow(s *state, cmd command, user database.User) error {
 }
 
 func handlerFollowing(s *state, cmd command, user database.User) error {
+	if err := noArgs(cmd); err != nil {
+		return err
+	}
 	userFollows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
 	if err != nil {
 		return fmt.Errorf("error getting feed follows for user: %w", err)
 	}
-	if len(userFollows) == 0 {
-		fmt.Println("No feed follows found for this user.")
-		return nil
-	}
-
-	fmt.Printf("Found %d feed follows for user %s:\n", len(userFollows), user.Name)
+	table := output.NewTable("feed_id", "feed_name", "feed_url", "user_name", "followed_at")
 	for _, feedFollow := range userFollows {
-		fmt.Printf("* %s\n", feedFollow.FeedName)
-		fmt.Println("=====================================")
+		table.Append(feedFollow.FeedID, feedFollow.FeedName, feedFollow.FeedUrl, feedFollow.UserName, feedFollow.CreatedAt)
 	}
-	return nil
+
+	return s.render(table, func() {
+		if len(userFollows) == 0 {
+			fmt.Println("No feed follows found for this user.")
+			return
+		}
+
+		fmt.Printf("Found %d feed follows for user %s:\n", len(userFollows), user.Name)
+		for _, feedFollow := range userFollows {
+			fmt.Printf("* %s\n", feedFollow.FeedName)
+			fmt.Println("=====================================")
+		}
+	})
 }
 
 func handlerUnfollow(s *state, cmd command, user database.User) error {
@@ -236,19 +416,30 @@ func handlerUnfollow(s *state, cmd command, user database.User) error {
 		UserID: user.ID,
 		FeedID: feed.ID,
 	}
-	err = s.db.DeleteFeedFollow(context.Background(), deleteFeedFollowParam)
+	removed, err := s.db.DeleteFeedFollow(context.Background(), deleteFeedFollowParam)
 	if err != nil {
 		return fmt.Errorf("couldn't delete feed follow: %w", err)
 	}
+	if removed == 0 {
+		return fmt.Errorf("you don't follow %s", feed.Name)
+	}
 
 	fmt.Printf("%s unfollowed successfully!\n", feed.Name)
 	return nil
 }
 
-func handlerBrowse(s * state, cmd command, user database.User) error {
+func handlerBrowse(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	raw := fs.Bool("raw", false, "print descriptions as stored, without rendering HTML")
+	width := fs.Int("width", 0, "wrap descriptions at this column")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil || len(args) > 1 {
+		return fmt.Errorf("usage: %s [limit] [--raw] [--width N]", cmd.Name)
+	}
+
 	limit := 2
-	if len(cmd.Args) == 1 {
-		if specLimit, err := strconv.Atoi(cmd.Args[0]); err == nil {
+	if len(args) == 1 {
+		if specLimit, err := strconv.Atoi(args[0]); err == nil {
 			limit = specLimit
 		} else {
 			return fmt.Errorf("invalid limit: %w", err)
@@ -257,22 +448,122 @@ func handlerBrowse(s * state, cmd command, user database.User) error {
 
 	getPostForUserParam := database.GetPostsForUserParams{
 		UserID: user.ID,
-		Limit: int32(limit),
+		Limit:  int32(limit),
 	}
 	posts, err := s.db.GetPostsForUser(context.Background(), getPostForUserParam)
 	if err != nil {
 		return fmt.Errorf("couldn't get posts for user: %w", err)
 	}
 
-	fmt.Printf("Found %d posts for user %s:\n", len(posts), user.Name)
+	postIDs := make([]uuid.UUID, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.ID
+	}
+	enclosures, err := s.db.GetEnclosuresForPosts(context.Background(), postIDs)
+	if err != nil {
+		return fmt.Errorf("couldn't get enclosures: %w", err)
+	}
+	enclosuresByPost := map[uuid.UUID][]database.Enclosure{}
+	for _, e := range enclosures {
+		enclosuresByPost[e.PostID] = append(enclosuresByPost[e.PostID], e)
+	}
+
+	table := output.NewTable("id", "title", "url", "feed_id", "feed_name", "published_at", "author", "categories", "comments_url", "enclosures", "description", "content")
 	for _, post := range posts {
-		fmt.Printf("%s from %s\n", post.PublishedAt.Time.Format("Mon Jan 2"), post.FeedName)
-		fmt.Printf("--- %s ---\n", post.Title)
-		fmt.Printf("    %v\n", post.Description.String)
-		fmt.Printf("Link: %s\n", post.Url)
-		fmt.Println("=====================================")
+		enclosureURLs := []string{}
+		for _, e := range enclosuresByPost[post.ID] {
+			enclosureURLs = append(enclosureURLs, e.Url)
+		}
+		table.Append(post.ID, post.Title, post.Url, post.FeedID, post.FeedName, nullTime(post.PublishedAt),
+			nullString(post.Author), post.Categories, nullString(post.CommentsUrl), enclosureURLs,
+			nullString(post.Description), nullString(post.Content))
+	}
+
+	opts := terminalRenderOptions(*width)
+	opts.Width -= 4
+	return s.render(table, func() {
+		fmt.Printf("Found %d posts for user %s:\n", len(posts), user.Name)
+		for _, post := range posts {
+			fmt.Printf("%s from %s\n", post.PublishedAt.Time.Format("Mon Jan 2"), post.FeedName)
+			fmt.Printf("--- %s ---\n", post.Title)
+			if post.Author.Valid {
+				fmt.Printf("By %s\n", post.Author.String)
+			}
+			if len(post.Categories) > 0 {
+				fmt.Printf("Categories: %s\n", strings.Join(post.Categories, ", "))
+			}
+			if *raw {
+				fmt.Printf("    %v\n", post.Description.String)
+			} else {
+				fmt.Println(indent(render.HTML(post.Description.String, opts), "    "))
+			}
+			fmt.Printf("Link: %s\n", post.Url)
+			if files := enclosuresByPost[post.ID]; len(files) > 0 {
+				fmt.Printf("Enclosures (gator download %s):\n", post.ID)
+				for _, e := range files {
+					fmt.Printf("  * %s\n", describeEnclosure(e))
+				}
+			}
+			fmt.Println("=====================================")
+		}
+	})
+}
+
+// render writes table in the output format selected with --output, or calls
+// text to print the human-readable layout.
+func (s *state) render(table *output.Table, text func()) error {
+	if s.format == output.Text || s.format == "" {
+		text()
+		return nil
 	}
-	return nil
+	return output.Write(os.Stdout, s.format, table)
+}
+
+// terminalRenderOptions picks the rendering options for descriptions printed
+// to stdout: color only on a terminal that allows it, and the terminal width
+// unless one is given.
+func terminalRenderOptions(width int) render.Options {
+	fd := int(os.Stdout.Fd())
+	isTerminal := term.IsTerminal(fd)
+	if width <= 0 {
+		width = render.DefaultWidth
+		if w, _, err := term.GetSize(fd); isTerminal && err == nil {
+			width = w
+		}
+	}
+	_, noColor := os.LookupEnv("NO_COLOR")
+	return render.Options{Width: width, Color: isTerminal && !noColor}
+}
+
+func indent(text, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// nullTime and nullString turn nullable columns into nil so that they are
+// rendered as null or an empty cell.
+func nullTime(t sql.NullTime) any {
+	if !t.Valid {
+		return nil
+	}
+	return t.Time
+}
+
+func nullString(str sql.NullString) any {
+	if !str.Valid {
+		return nil
+	}
+	return str.String
+}
+
+// optionalString stores empty strings as NULL.
+func optionalString(str string) sql.NullString {
+	return sql.NullString{String: str, Valid: str != ""}
 }
 
 func printUser(user database.User) {
@@ -288,6 +579,18 @@ func printFeed(feed database.Feed, user database.User) {
 	fmt.Printf("* Created:       %v\n", feed.CreatedAt)
 	fmt.Printf("* Updated:       %v\n", feed.UpdatedAt)
 	fmt.Printf("* LastFetchedAt: %v\n", feed.LastFetchedAt.Time)
+	if len(feed.Credentials) > 0 {
+		fmt.Println("* Auth:          stored (encrypted)")
+	}
+}
+
+// feedStatus summarises the outcome of a collection, such as "ok" or
+// "skipped: robots.txt disallows ...".
+func feedStatus(fetch database.FeedFetch) string {
+	if fetch.Error.Valid {
+		return fetch.Status + ": " + fetch.Error.String
+	}
+	return fetch.Status
 }
 
 func printFeedFollow(username, feedname string) {
@@ -295,35 +598,135 @@ func printFeedFollow(username, feedname string) {
 	fmt.Printf("* Feed:          %s\n", feedname)
 }
 
-func scrapeFeeds(s *state) {
+// scrapeFeeds collects the feed that has waited longest. It reports
+// whether that went well, which is also the case when there was nothing
+// to collect.
+func scrapeFeeds(s *state) bool {
 	feed, err := s.db.GetNextFeedToFetch(context.Background())
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Debug("no feeds to collect")
+		return true
+	}
+	if err != nil {
+		slog.Error("couldn't get next feed to collect", "error", err)
+		return false
+	}
+	return scrapeFeed(s, feed) == nil
+}
+
+// describeFetchError explains a failed collection, telling apart the
+// failures that are worth retrying from the ones that need a fix.
+func describeFetchError(err error) string {
+	var statusErr *HTTPStatusError
+	var timeoutErr *TimeoutError
+	var limitedErr *RateLimitedError
+	switch {
+	case errors.As(err, &statusErr) && !statusErr.Temporary():
+		return fmt.Sprintf("%v, check the feed URL", err)
+	case errors.As(err, &statusErr), errors.As(err, &timeoutErr), errors.As(err, &limitedErr):
+		return fmt.Sprintf("%v, will retry on a later pass", err)
+	}
+	return err.Error()
+}
+
+// scrapeFeed collects feed and logs the outcome. Fetch failures are
+// returned as-is, so they can be matched against HTTPStatusError,
+// ParseError, TimeoutError and TooLargeError.
+func scrapeFeed(s *state, feed database.Feed) error {
+	start := time.Now()
+	result, err := collectFeed(context.Background(), s, feed)
+	logger := slog.With("feed_id", feed.ID, "feed_url", feed.Url, "duration", time.Since(start))
 	if err != nil {
-		fmt.Println("couldn't fetch next feed:", err)
-		return
+		logger.Error("couldn't collect feed", "error", describeFetchError(err))
+		return err
+	}
+	if result.moved != "" {
+		logger.Info("feed "+result.moved, "new_feed_id", result.feedID)
+	}
+	if result.hubErr != nil {
+		logger.Warn("couldn't subscribe to WebSub hub", "error", result.hubErr)
+	}
+	for _, err := range result.postErrs {
+		logger.Error("couldn't create post", "error", err)
 	}
-	fmt.Println("Found a feed to fetch")
+	logger.Info("feed collected",
+		"feed_name", feed.Name,
+		"posts_found", result.found,
+		"posts_inserted", result.inserted,
+		"parse_warnings", result.parseWarnings)
+	return nil
+}
+
+// scrapeResult summarises a single collection of a feed.
+type scrapeResult struct {
+	found         int
+	inserted      int
+	parseWarnings int
+	postErrs      []error
+	// feedID is the feed the posts were stored under, which differs from
+	// the collected one when it was merged after a permanent redirect.
+	feedID     uuid.UUID
+	statusCode int
+	// moved describes a change of URL, if any.
+	moved string
+	// pushed is set for content delivered by a WebSub hub.
+	pushed bool
+	hubErr error
+}
 
-	scrapeFeed(s.db, feed)
+// collectFeed fetches feed and stores its new posts without printing
+// anything, so it can also be used from the terminal UI. Every collection,
+// failed or not, is added to the feed's fetch history.
+func collectFeed(ctx context.Context, s *state, feed database.Feed) (scrapeResult, error) {
+	result, err := ingestFeed(ctx, s, feed)
+	if recordErr := recordFetch(ctx, s.db, result.feedID, result, err); recordErr != nil && err == nil {
+		return result, fmt.Errorf("couldn't record fetch: %w", recordErr)
+	}
+	return result, err
 }
 
-func scrapeFeed(db *database.Queries, feed database.Feed) {
-	_, err := db.MarkFeedFetched(context.Background(), feed.ID)
+func ingestFeed(ctx context.Context, s *state, feed database.Feed) (scrapeResult, error) {
+	db := s.db
+	result := scrapeResult{feedID: feed.ID}
+	_, err := db.MarkFeedFetched(ctx, feed.ID)
 	if err != nil {
-		fmt.Printf("couldn't mark feed %s as fetched: %v\n", feed.Name, err)
-		return
+		return result, fmt.Errorf("couldn't mark feed as fetched: %w", err)
 	}
 
-	feedData, err := fetchFeed(context.Background(), feed.Url)
+	header, err := s.feedHeader(feed)
 	if err != nil {
-		fmt.Printf("couldn't collect feed %s: %v", feed.Name, err)
-		return
+		return result, err
 	}
+	fetched, err := s.fetcher.fetch(ctx, feed.Url, header)
+	result.statusCode = fetched.StatusCode
+	if err != nil {
+		return result, err
+	}
+	if fetched.MovedTo != "" && fetched.MovedTo != feed.Url {
+		feed, result.moved, err = relocateFeed(ctx, s, feed, fetched.MovedTo)
+		if err != nil {
+			return result, err
+		}
+		result.feedID = feed.ID
+	}
+	result.parseWarnings = fetched.ParseWarnings
+	storeItems(ctx, db, feed.ID, fetched.Feed.Channel.Item, &result)
 
-	for _, rssItem := range feedData.Channel.Item {
+	if hub := fetched.Feed.Channel.Hub; hub != "" {
+		result.hubErr = s.subscribeDiscovered(ctx, feed, hub, fetched.Feed.Channel.Self)
+	}
+	return result, nil
+}
+
+// storeItems saves items as posts of feedID, skipping the ones already
+// stored, and counts them in result. Polling and WebSub pushes both store
+// their items through it.
+func storeItems(ctx context.Context, db *database.Queries, feedID uuid.UUID, items []RSSItem, result *scrapeResult) {
+	for _, rssItem := range items {
 		publishedAt := sql.NullTime{}
 		if t, err := time.Parse(time.RFC1123Z, rssItem.PubDate); err == nil {
 			publishedAt = sql.NullTime{
-				Time: t,
+				Time:  t,
 				Valid: true,
 			}
 		}
@@ -333,18 +736,40 @@ func scrapeFeed(db *database.Queries, feed database.Feed) {
 			UpdatedAt:   time.Now().UTC(),
 			Title:       rssItem.Title,
 			Url:         rssItem.Link,
-			Description: sql.NullString{String: rssItem.Description, Valid: true},
+			Description: sql.NullString{String: sanitize.HTML(rssItem.Description, rssItem.Link), Valid: true},
 			PublishedAt: publishedAt,
-			FeedID:      feed.ID,
+			FeedID:      feedID,
+			Content:     optionalString(sanitize.HTML(rssItem.Content, rssItem.Link)),
+			Author:      optionalString(rssItem.AuthorName()),
+			Categories:  rssItem.Categories,
+			CommentsUrl: optionalString(strings.TrimSpace(rssItem.Comments)),
+		}
+		if postParams.Categories == nil {
+			postParams.Categories = []string{}
 		}
-		_, err := db.CreatePost(context.Background(), postParams)
+		post, err := db.CreatePost(ctx, postParams)
 		if err != nil {
 			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+				postsDuplicateTotal.Inc()
 				continue
 			}
-			fmt.Printf("couldn't create post: %v", err)
+			result.postErrs = append(result.postErrs, err)
 			continue
 		}
+		result.inserted++
+		postsInsertedTotal.Inc()
+		// Keywords are matched against the text of the post rather than its
+		// HTML, so that "href" doesn't match every link.
+		if _, err := db.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+			PostID: post.ID,
+			Text:   post.Title + " " + sanitize.Text(post.Description.String),
+		}); err != nil {
+			result.postErrs = append(result.postErrs, fmt.Errorf("couldn't queue webhooks: %w", err))
+		}
+
+		if err := storeEnclosures(ctx, db, post.ID, rssItem.MediaFiles()); err != nil {
+			result.postErrs = append(result.postErrs, err)
+		}
 	}
-	fmt.Printf("Feed %s collected, %v posts found\n", feed.Name, len(feedData.Channel.Item))
+	result.found += len(items)
 }
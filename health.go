@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// schemaFiles are the goose migrations the binary was built with, so
+// readiness can tell whether the database has caught up with them.
+//
+//go:embed sql/schema/*.sql
+var schemaFiles embed.FS
+
+const healthCheckTimeout = 2 * time.Second
+
+// aggHealth answers the probes of a running agg. A scrape counts as
+// successful when it collected a feed or found none to collect.
+type aggHealth struct {
+	s        *state
+	interval time.Duration
+	// maxMissed is how many intervals may pass without a successful
+	// scrape before agg stops being ready.
+	maxMissed int
+	// lastSuccess is a Unix time in nanoseconds; it starts out as the time
+	// agg started so that it is ready while collecting the first feed.
+	lastSuccess atomic.Int64
+}
+
+func newAggHealth(s *state, interval time.Duration, maxMissed int) *aggHealth {
+	h := &aggHealth{s: s, interval: interval, maxMissed: maxMissed}
+	h.scraped()
+	return h
+}
+
+func (h *aggHealth) scraped() {
+	h.lastSuccess.Store(time.Now().UnixNano())
+}
+
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+type healthCheck struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func passed(detail string) healthCheck {
+	return healthCheck{Status: "ok", Detail: detail}
+}
+
+func failed(detail string) healthCheck {
+	return healthCheck{Status: "fail", Detail: detail}
+}
+
+func (h *aggHealth) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, map[string]healthCheck{
+			"database": h.checkDatabase(r.Context()),
+		})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, map[string]healthCheck{
+			"database":   h.checkDatabase(r.Context()),
+			"migrations": h.checkMigrations(r.Context()),
+			"scrape":     h.checkScrape(),
+		})
+	})
+}
+
+// writeHealth responds 200 when every check passed and 503 otherwise.
+func writeHealth(w http.ResponseWriter, checks map[string]healthCheck) {
+	report := healthReport{Status: "ok", Checks: checks}
+	status := http.StatusOK
+	for _, check := range checks {
+		if check.Status != "ok" {
+			report.Status = "fail"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, report)
+}
+
+func (h *aggHealth) checkDatabase(ctx context.Context) healthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	if err := h.s.sqlDB.PingContext(ctx); err != nil {
+		return failed(err.Error())
+	}
+	return passed("")
+}
+
+// checkMigrations compares the newest migration applied by goose with the
+// newest one embedded in the binary.
+func (h *aggHealth) checkMigrations(ctx context.Context) healthCheck {
+	expected, err := latestMigration()
+	if err != nil {
+		return failed(err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	var current int64
+	err = h.s.sqlDB.QueryRowContext(ctx,
+		"SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied").Scan(&current)
+	if err != nil {
+		return failed(fmt.Sprintf("couldn't read migration version: %v", err))
+	}
+
+	detail := fmt.Sprintf("at version %d of %d", current, expected)
+	if current < expected {
+		return failed(detail)
+	}
+	return passed(detail)
+}
+
+func (h *aggHealth) checkScrape() healthCheck {
+	last := time.Unix(0, h.lastSuccess.Load())
+	age := time.Since(last).Round(time.Second)
+	limit := time.Duration(h.maxMissed) * h.interval
+	detail := fmt.Sprintf("last successful scrape %s ago, limit %s", age, limit)
+	if age > limit {
+		return failed(detail)
+	}
+	return passed(detail)
+}
+
+// latestMigration returns the highest version among the embedded
+// migrations, which are named like "013_user_passwords.sql".
+func latestMigration() (int64, error) {
+	entries, err := fs.ReadDir(schemaFiles, "sql/schema")
+	if err != nil {
+		return 0, err
+	}
+	var latest int64
+	for _, entry := range entries {
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s has no version prefix", entry.Name())
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBackoff is how long a host is left alone after a 429 without a
+// Retry-After header.
+const defaultBackoff = time.Minute
+
+// hostLimiter keeps requests to each host polite: a token bucket spaces
+// them out, a semaphore caps how many are in flight and a host that asked
+// us to back off is not contacted until it said we may.
+type hostLimiter struct {
+	rate        float64
+	burst       int
+	concurrency int
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	tokens float64
+	last   time.Time
+	// blockedUntil is set from Retry-After on 429 and 503 responses.
+	blockedUntil time.Time
+	slots        chan struct{}
+}
+
+func newHostLimiter(rate float64, burst, concurrency int) *hostLimiter {
+	return &hostLimiter{
+		rate:        rate,
+		burst:       burst,
+		concurrency: concurrency,
+		hosts:       make(map[string]*hostState),
+	}
+}
+
+func (l *hostLimiter) host(name string) *hostState {
+	name = strings.ToLower(name)
+	h, ok := l.hosts[name]
+	if !ok {
+		h = &hostState{
+			tokens: float64(l.burst),
+			last:   time.Now(),
+			slots:  make(chan struct{}, l.concurrency),
+		}
+		l.hosts[name] = h
+	}
+	return h
+}
+
+// acquire waits until a request to host may be sent and returns the
+// function that ends it. A host that is backing off fails right away with
+// a RateLimitedError rather than holding up every other feed.
+func (l *hostLimiter) acquire(ctx context.Context, host, rawURL string) (func(), error) {
+	l.mu.Lock()
+	h := l.host(host)
+	l.mu.Unlock()
+
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-h.slots }
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if now.Before(h.blockedUntil) {
+			until := h.blockedUntil
+			l.mu.Unlock()
+			release()
+			return nil, &RateLimitedError{URL: rawURL, Until: until}
+		}
+		h.tokens = min(h.tokens+now.Sub(h.last).Seconds()*l.rate, float64(l.burst))
+		h.last = now
+		if h.tokens >= 1 {
+			h.tokens--
+			l.mu.Unlock()
+			return release, nil
+		}
+		wait := time.Duration((1 - h.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// backOff stops requests to host until the given time.
+func (l *hostLimiter) backOff(host string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	h := l.host(host)
+	if until.After(h.blockedUntil) {
+		h.blockedUntil = until
+	}
+}
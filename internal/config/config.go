@@ -10,8 +10,103 @@ import (
 const configFileName = ".gatorconfig.json"
 
 type Config struct {
-	DBUrl           string `json:"db_url"`
-	CurrentUserName string `json:"current_user_name"`
+	DBUrl           string      `json:"db_url"`
+	CurrentUserName string      `json:"current_user_name"`
+	Fetch           FetchConfig `json:"fetch,omitzero"`
+	Serve           ServeConfig `json:"serve,omitzero"`
+	Log             LogConfig   `json:"log,omitzero"`
+	// SecretKey is a base64 AES-256 key encrypting feed credentials. The
+	// GATOR_SECRET_KEY environment variable takes precedence.
+	SecretKey string `json:"secret_key,omitempty"`
+}
+
+// FetchConfig controls how feeds are downloaded.
+type FetchConfig struct {
+	// MaxBodyBytes caps the size of a feed after decompression. Zero means
+	// DefaultMaxBodyBytes.
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+	// Timeout is a duration such as "30s"; it defaults to 10s.
+	Timeout string `json:"timeout,omitempty"`
+	// UserAgent replaces the default "gator/<version> (+<contact_url>)".
+	UserAgent  string `json:"user_agent,omitempty"`
+	ContactURL string `json:"contact_url,omitempty"`
+	// Proxy is used for every request instead of the HTTP_PROXY and
+	// HTTPS_PROXY environment variables.
+	Proxy string `json:"proxy,omitempty"`
+	// CABundle is a PEM file of extra certificate authorities to trust.
+	CABundle string `json:"ca_bundle,omitempty"`
+	// Headers adds request headers per feed URL.
+	Headers map[string]map[string]string `json:"headers,omitempty"`
+	// HostRate is the sustained number of requests per second sent to any
+	// one host, and HostBurst how many may go out back to back.
+	HostRate  float64 `json:"host_rate,omitempty"`
+	HostBurst int     `json:"host_burst,omitempty"`
+	// HostConcurrency caps the requests in flight to any one host.
+	HostConcurrency int `json:"host_concurrency,omitempty"`
+	// RespectRobots skips feeds that a host's robots.txt disallows for
+	// the gator User-Agent.
+	RespectRobots bool `json:"respect_robots,omitempty"`
+}
+
+// ServeConfig controls the HTTP listener started by "gator serve".
+type ServeConfig struct {
+	// Addr is the address to listen on; it defaults to DefaultServeAddr.
+	Addr string `json:"addr,omitempty"`
+	// PublicURL is where the listener can be reached by others, such as
+	// "https://gator.example.com". WebSub hubs are only subscribed to when
+	// it is set, since they need it to deliver content.
+	PublicURL string `json:"public_url,omitempty"`
+	// SessionKey is a base64 key of 32 bytes signing the web UI's session
+	// and CSRF cookies. Without one a random key is used, so sessions end
+	// when the server restarts.
+	SessionKey string `json:"session_key,omitempty"`
+}
+
+// LogConfig controls the operational logs written to stderr by agg and
+// serve. Command output meant for the user still goes to stdout.
+type LogConfig struct {
+	// Level is "debug", "info" (the default), "warn" or "error".
+	Level string `json:"level,omitempty"`
+	// Format is "text" (the default) or "json". The --log-format flag
+	// takes precedence.
+	Format string `json:"format,omitempty"`
+}
+
+const DefaultServeAddr = ":8080"
+
+func (sc ServeConfig) ListenAddr() string {
+	if sc.Addr == "" {
+		return DefaultServeAddr
+	}
+	return sc.Addr
+}
+
+const (
+	DefaultMaxBodyBytes    = 10 << 20
+	DefaultHostRate        = 1.0
+	DefaultHostBurst       = 2
+	DefaultHostConcurrency = 2
+)
+
+func (fc FetchConfig) BodyLimit() int64 {
+	if fc.MaxBodyBytes <= 0 {
+		return DefaultMaxBodyBytes
+	}
+	return fc.MaxBodyBytes
+}
+
+func (fc FetchConfig) HostLimits() (rate float64, burst, concurrency int) {
+	rate, burst, concurrency = fc.HostRate, fc.HostBurst, fc.HostConcurrency
+	if rate <= 0 {
+		rate = DefaultHostRate
+	}
+	if burst <= 0 {
+		burst = DefaultHostBurst
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultHostConcurrency
+	}
+	return rate, burst, concurrency
 }
 
 func Read() (Config, error) {
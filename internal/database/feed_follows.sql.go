@@ -72,7 +72,7 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 	return i, err
 }
 
-const deleteFeedFollow = `-- name: DeleteFeedFollow :exec
+const deleteFeedFollow = `-- name: DeleteFeedFollow :execrows
 
 DELETE FROM feed_follows
 WHERE user_id = $1 AND feed_id = $2
@@ -83,15 +83,18 @@ type DeleteFeedFollowParams struct {
 	FeedID uuid.UUID
 }
 
-func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowParams) error {
-	_, err := q.db.ExecContext(ctx, deleteFeedFollow, arg.UserID, arg.FeedID)
-	return err
+func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFeedFollow, arg.UserID, arg.FeedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
 
 SELECT 
-    ff.id, ff.created_at, ff.updated_at, ff.user_id, ff.feed_id, f.name AS feed_name, u.name AS user_name
+    ff.id, ff.created_at, ff.updated_at, ff.user_id, ff.feed_id, f.name AS feed_name, f.url AS feed_url, u.name AS user_name
 FROM feed_follows ff
 INNER JOIN users u ON ff.user_id = u.id
 INNER JOIN feeds f ON ff.feed_id = f.id 
@@ -105,6 +108,7 @@ type GetFeedFollowsForUserRow struct {
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
 	FeedName  string
+	FeedUrl   string
 	UserName  string
 }
 
@@ -124,6 +128,7 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 			&i.UserID,
 			&i.FeedID,
 			&i.FeedName,
+			&i.FeedUrl,
 			&i.UserName,
 		); err != nil {
 			return nil, err
@@ -138,3 +143,84 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 	}
 	return items, nil
 }
+
+const listFeedFollowsForUser = `-- name: ListFeedFollowsForUser :many
+
+SELECT
+    ff.id, ff.created_at, ff.updated_at, ff.user_id, ff.feed_id, f.name AS feed_name, f.url AS feed_url, u.name AS user_name
+FROM feed_follows ff
+INNER JOIN users u ON ff.user_id = u.id
+INNER JOIN feeds f ON ff.feed_id = f.id
+WHERE ff.user_id = $1
+ORDER BY ff.created_at, ff.id
+LIMIT $2 OFFSET $3
+`
+
+type ListFeedFollowsForUserParams struct {
+	UserID uuid.UUID
+	Limit  int32
+	Offset int32
+}
+
+type ListFeedFollowsForUserRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	FeedID    uuid.UUID
+	FeedName  string
+	FeedUrl   string
+	UserName  string
+}
+
+func (q *Queries) ListFeedFollowsForUser(ctx context.Context, arg ListFeedFollowsForUserParams) ([]ListFeedFollowsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, listFeedFollowsForUser, arg.UserID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFeedFollowsForUserRow
+	for rows.Next() {
+		var i ListFeedFollowsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.FeedID,
+			&i.FeedName,
+			&i.FeedUrl,
+			&i.UserName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const moveFeedFollows = `-- name: MoveFeedFollows :exec
+
+UPDATE feed_follows
+SET feed_id = $1, updated_at = NOW()
+WHERE feed_id = $2
+    AND user_id NOT IN (
+        SELECT user_id FROM feed_follows WHERE feed_id = $1
+    )
+`
+
+type MoveFeedFollowsParams struct {
+	ToFeedID   uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+func (q *Queries) MoveFeedFollows(ctx context.Context, arg MoveFeedFollowsParams) error {
+	_, err := q.db.ExecContext(ctx, moveFeedFollows, arg.ToFeedID, arg.FromFeedID)
+	return err
+}
@@ -13,25 +13,27 @@ import (
 )
 
 const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds (id, name, url, user_id, created_at, updated_at)
+INSERT INTO feeds (id, name, url, user_id, created_at, updated_at, credentials)
 VALUES (
     $1,
     $2,
     $3,
     $4,
     $5,
-    $6
+    $6,
+    $7
 )
-RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at
+RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at, credentials
 `
 
 type CreateFeedParams struct {
-	ID        uuid.UUID
-	Name      string
-	Url       string
-	UserID    uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          uuid.UUID
+	Name        string
+	Url         string
+	UserID      uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Credentials []byte
 }
 
 func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
@@ -42,6 +44,7 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		arg.UserID,
 		arg.CreatedAt,
 		arg.UpdatedAt,
+		arg.Credentials,
 	)
 	var i Feed
 	err := row.Scan(
@@ -52,12 +55,45 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.LastFetchedAt,
+		&i.Credentials,
+	)
+	return i, err
+}
+
+const deleteFeed = `-- name: DeleteFeed :exec
+DELETE FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
+const getFeedById = `-- name: GetFeedById :one
+SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at, credentials
+FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) GetFeedById(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedById, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.Credentials,
 	)
 	return i, err
 }
 
 const getFeedByUrl = `-- name: GetFeedByUrl :one
-SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at
+SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at, credentials
 FROM feeds
 WHERE url = $1
 `
@@ -73,12 +109,13 @@ func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.LastFetchedAt,
+		&i.Credentials,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at FROM feeds
+SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at, credentials FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -98,6 +135,7 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.LastFetchedAt,
+			&i.Credentials,
 		); err != nil {
 			return nil, err
 		}
@@ -113,8 +151,14 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 }
 
 const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at
+SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at, credentials
 FROM feeds
+WHERE NOT EXISTS (
+    SELECT 1 FROM websub_subscriptions
+    WHERE websub_subscriptions.feed_id = feeds.id
+        AND websub_subscriptions.state = 'active'
+        AND websub_subscriptions.lease_expires_at > NOW()
+)
 ORDER BY last_fetched_at ASC NULLS FIRST
 LIMIT 1
 `
@@ -130,15 +174,83 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.LastFetchedAt,
+		&i.Credentials,
 	)
 	return i, err
 }
 
+const getQueueLag = `-- name: GetQueueLag :one
+SELECT EXTRACT(EPOCH FROM CASE
+        WHEN last_fetched_at IS NULL THEN (NOW() AT TIME ZONE 'UTC') - created_at
+        ELSE LOCALTIMESTAMP - last_fetched_at
+    END)::float8 AS lag_seconds
+FROM feeds
+WHERE NOT EXISTS (
+    SELECT 1 FROM websub_subscriptions
+    WHERE websub_subscriptions.feed_id = feeds.id
+        AND websub_subscriptions.state = 'active'
+        AND websub_subscriptions.lease_expires_at > NOW()
+)
+ORDER BY last_fetched_at ASC NULLS FIRST
+LIMIT 1
+`
+
+func (q *Queries) GetQueueLag(ctx context.Context) (float64, error) {
+	row := q.db.QueryRowContext(ctx, getQueueLag)
+	var lag_seconds float64
+	err := row.Scan(&lag_seconds)
+	return lag_seconds, err
+}
+
+const listFeeds = `-- name: ListFeeds :many
+SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at, credentials
+FROM feeds
+ORDER BY created_at, id
+LIMIT $1 OFFSET $2
+`
+
+type ListFeedsParams struct {
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) ListFeeds(ctx context.Context, arg ListFeedsParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, listFeeds, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.LastFetchedAt,
+			&i.Credentials,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const markFeedFetched = `-- name: MarkFeedFetched :one
 UPDATE feeds 
 SET updated_at = NOW(), last_fetched_at = NOW()
 WHERE id = $1
-RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at
+RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at, credentials
 `
 
 func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
@@ -152,6 +264,63 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, erro
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.LastFetchedAt,
+		&i.Credentials,
+	)
+	return i, err
+}
+
+const setFeedCredentials = `-- name: SetFeedCredentials :one
+UPDATE feeds
+SET credentials = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at, credentials
+`
+
+type SetFeedCredentialsParams struct {
+	ID          uuid.UUID
+	Credentials []byte
+}
+
+func (q *Queries) SetFeedCredentials(ctx context.Context, arg SetFeedCredentialsParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedCredentials, arg.ID, arg.Credentials)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.Credentials,
+	)
+	return i, err
+}
+
+const updateFeedUrl = `-- name: UpdateFeedUrl :one
+UPDATE feeds
+SET url = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at, credentials
+`
+
+type UpdateFeedUrlParams struct {
+	ID  uuid.UUID
+	Url string
+}
+
+func (q *Queries) UpdateFeedUrl(ctx context.Context, arg UpdateFeedUrlParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, updateFeedUrl, arg.ID, arg.Url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.Credentials,
 	)
 	return i, err
 }
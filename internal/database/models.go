@@ -11,6 +11,27 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  []byte
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type Enclosure struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	PostID          uuid.UUID
+	Url             string
+	MimeType        sql.NullString
+	Length          sql.NullInt64
+	DurationSeconds sql.NullInt32
+}
+
 type Feed struct {
 	ID            uuid.UUID
 	Name          string
@@ -19,6 +40,19 @@ type Feed struct {
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	LastFetchedAt sql.NullTime
+	Credentials   []byte
+}
+
+type FeedFetch struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	FeedID        uuid.UUID
+	Status        string
+	HttpStatus    sql.NullInt32
+	PostsFound    int32
+	PostsInserted int32
+	Error         sql.NullString
+	Message       sql.NullString
 }
 
 type FeedFollow struct {
@@ -38,11 +72,62 @@ type Post struct {
 	Description sql.NullString
 	PublishedAt sql.NullTime
 	FeedID      uuid.UUID
+	Content     sql.NullString
+	Author      sql.NullString
+	Categories  []string
+	CommentsUrl sql.NullString
 }
 
-type User struct {
+type PostState struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Name      string
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	ReadAt    sql.NullTime
+	Starred   bool
+}
+
+type User struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Name           string
+	HashedPassword sql.NullString
+}
+
+type Webhook struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Url       string
+	FeedID    uuid.NullUUID
+	Keyword   sql.NullString
+	Secret    string
+}
+
+type WebhookDelivery struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	WebhookID     uuid.UUID
+	PostID        uuid.UUID
+	State         string
+	Attempts      int32
+	NextAttemptAt time.Time
+	LastStatus    sql.NullInt32
+	LastError     sql.NullString
+	DeliveredAt   sql.NullTime
+}
+
+type WebsubSubscription struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	FeedID         uuid.UUID
+	HubUrl         string
+	TopicUrl       string
+	Secret         string
+	State          string
+	LeaseExpiresAt sql.NullTime
 }
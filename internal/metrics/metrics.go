@@ -0,0 +1,254 @@
+// Package metrics keeps counters, gauges and histograms in memory and
+// writes them in the Prometheus text exposition format, so a long-running
+// gator can be scraped without pulling in a client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets suits latencies measured in seconds.
+var DefBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry holds metrics in the order they were created.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type kind string
+
+const (
+	counterKind   kind = "counter"
+	gaugeKind     kind = "gauge"
+	histogramKind kind = "histogram"
+)
+
+// metric is a family of series sharing a name and label names. Series are
+// keyed by their label values joined with a separator that can't occur in
+// valid UTF-8.
+type metric struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// counts holds, for histograms, the observations per bucket; the last
+	// entry is the +Inf bucket.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+const keySep = "\xff"
+
+func (r *Registry) register(name, help string, k kind, buckets []float64, labels []string) *metric {
+	m := &metric{
+		name:    name,
+		help:    help,
+		kind:    k,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*series{},
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+	if len(labels) == 0 {
+		m.get(nil)
+	}
+	return m
+}
+
+// get returns the series for labelValues, creating it. The registry lock
+// must be held.
+func (m *metric) get(labelValues []string) *series {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", m.name, len(m.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, keySep)
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: slices.Clone(labelValues)}
+		if m.kind == histogramKind {
+			s.counts = make([]uint64, len(m.buckets)+1)
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Counter is a value that only goes up, such as a number of requests.
+type Counter struct {
+	r *Registry
+	m *metric
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r: r, m: r.register(name, help, counterKind, nil, labels)}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter by v, which must not be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.m.name + " decreased")
+	}
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.m.get(labelValues).value += v
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	r *Registry
+	m *metric
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r: r, m: r.register(name, help, gaugeKind, nil, labels)}
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.r.mu.Lock()
+	defer g.r.mu.Unlock()
+	g.m.get(labelValues).value = v
+}
+
+// Histogram counts observations, such as latencies, in buckets given by
+// their inclusive upper bounds.
+type Histogram struct {
+	r *Registry
+	m *metric
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return &Histogram{r: r, m: r.register(name, help, histogramKind, buckets, labels)}
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	s := h.m.get(labelValues)
+	i, _ := slices.BinarySearch(h.m.buckets, v)
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+// WriteText writes every metric in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range r.metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.kind)
+
+		keys := make([]string, 0, len(m.series))
+		for key := range m.series {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			s := m.series[key]
+			if m.kind != histogramKind {
+				fmt.Fprintf(bw, "%s%s %s\n", m.name, labelPairs(m.labels, s.labelValues, "", ""), formatFloat(s.value))
+				continue
+			}
+			var cumulative uint64
+			for i, count := range s.counts {
+				cumulative += count
+				le := math.Inf(1)
+				if i < len(m.buckets) {
+					le = m.buckets[i]
+				}
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", m.name, labelPairs(m.labels, s.labelValues, "le", formatFloat(le)), cumulative)
+			}
+			fmt.Fprintf(bw, "%s_sum%s %s\n", m.name, labelPairs(m.labels, s.labelValues, "", ""), formatFloat(s.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", m.name, labelPairs(m.labels, s.labelValues, "", ""), s.count)
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry to Prometheus.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// labelPairs formats labels as {a="x",b="y"}, adding extra unless its name
+// is empty.
+func labelPairs(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeLabel(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extraName, escapeLabel(extraValue))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests by path\nand \\ status.", "path", "code")
+	inFlight := r.NewGauge("in_flight", "Requests being served.")
+	latency := r.NewHistogram("latency_seconds", "Request latency.", []float64{1, 0.1, 0.5})
+
+	requests.Inc("/b", "200")
+	requests.Add(2, `/a"quoted"\path`+"\n", "500")
+	inFlight.Set(-1.5)
+	latency.Observe(0.05)
+	latency.Observe(0.1)
+	latency.Observe(0.7)
+	latency.Observe(3)
+
+	want := `# HELP requests_total Requests by path\nand \\ status.
+# TYPE requests_total counter
+requests_total{path="/a\"quoted\"\\path\n",code="500"} 2
+requests_total{path="/b",code="200"} 1
+# HELP in_flight Requests being served.
+# TYPE in_flight gauge
+in_flight -1.5
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="0.5"} 2
+latency_seconds_bucket{le="1"} 3
+latency_seconds_bucket{le="+Inf"} 4
+latency_seconds_sum 3.85
+latency_seconds_count 4
+`
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("WriteText wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteTextLabeledHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("size_bytes", "Sizes.", []float64{10}, "kind")
+	h.Observe(5, "feed")
+
+	want := `# HELP size_bytes Sizes.
+# TYPE size_bytes histogram
+size_bytes_bucket{kind="feed",le="10"} 1
+size_bytes_bucket{kind="feed",le="+Inf"} 1
+size_bytes_sum{kind="feed"} 5
+size_bytes_count{kind="feed"} 1
+`
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("WriteText wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLabeledMetricWithoutSeries(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("errors_total", "Errors.", "kind")
+
+	want := "# HELP errors_total Errors.\n# TYPE errors_total counter\n"
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("WriteText wrote %q, want %q", got, want)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := map[float64]string{
+		0:            "0",
+		1e21:         "1e+21",
+		0.25:         "0.25",
+		math.Inf(1):  "+Inf",
+		math.Inf(-1): "-Inf",
+		math.NaN():   "NaN",
+	}
+	for v, want := range tests {
+		if got := formatFloat(v); got != want {
+			t.Errorf("formatFloat(%v) = %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestHandlerContentType(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewRegistry().Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+}
+
+func TestCounterRejectsWrongLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	NewRegistry().NewCounter("c_total", "C.", "a").Inc()
+}
@@ -0,0 +1,136 @@
+// Package output renders command listings in machine-readable formats so
+// gator can be piped into tools like jq or a spreadsheet.
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	Text Format = "text"
+	JSON Format = "json"
+	CSV  Format = "csv"
+	TSV  Format = "tsv"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case Text, JSON, CSV, TSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (expected text, json, csv or tsv)", s)
+}
+
+// Table is a listing whose rows all share the same columns. Values are kept
+// as-is for JSON and formatted as strings for CSV and TSV; a nil value is
+// rendered as null or an empty cell.
+type Table struct {
+	Columns []string
+	Rows    [][]any
+}
+
+func NewTable(columns ...string) *Table {
+	return &Table{Columns: columns}
+}
+
+func (t *Table) Append(values ...any) {
+	t.Rows = append(t.Rows, values)
+}
+
+// Write renders t to w. The text format is not handled here: each command
+// keeps its own human-readable layout.
+func Write(w io.Writer, format Format, t *Table) error {
+	switch format {
+	case JSON:
+		return writeJSON(w, t)
+	case CSV:
+		return writeDelimited(w, ',', t)
+	case TSV:
+		return writeDelimited(w, '\t', t)
+	}
+	return fmt.Errorf("output format %q cannot render a table", format)
+}
+
+// record marshals a row as a JSON object whose keys keep the column order.
+type record struct {
+	columns []string
+	values  []any
+}
+
+func (r record) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range r.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func writeJSON(w io.Writer, t *Table) error {
+	records := make([]record, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		records = append(records, record{columns: t.Columns, values: row})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+func writeDelimited(w io.Writer, comma rune, t *Table) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+
+	if err := cw.Write(t.Columns); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		fields := make([]string, len(row))
+		for i, value := range row {
+			fields[i] = formatValue(value)
+		}
+		if err := cw.Write(fields); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, ", ")
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,384 @@
+// Package publish writes a list of posts as an Atom, RSS 2.0 or JSON Feed
+// document, so a gator timeline can be read by other feed readers.
+package publish
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type Format string
+
+// ErrNoLink is returned when writing an RSS feed with neither a Link nor a
+// SelfLink, since RSS 2.0 requires every channel to have a link.
+var ErrNoLink = errors.New("an RSS feed needs a link")
+
+const (
+	Atom     Format = "atom"
+	RSS      Format = "rss"
+	JSONFeed Format = "jsonfeed"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case Atom, RSS, JSONFeed:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown feed format %q (expected atom, rss or jsonfeed)", s)
+}
+
+// ContentType is the media type documents of format are served with.
+func (f Format) ContentType() string {
+	switch f {
+	case Atom:
+		return "application/atom+xml; charset=utf-8"
+	case RSS:
+		return "application/rss+xml; charset=utf-8"
+	}
+	return "application/feed+json; charset=utf-8"
+}
+
+// Feed is a format-independent description of the document to write.
+type Feed struct {
+	// ID is a permanent identifier, such as "urn:uuid:...".
+	ID          string
+	Title       string
+	Description string
+	// Link is the web page of the feed and SelfLink the URL of the
+	// document itself. Either may be empty when unknown, but RSS needs at
+	// least one of them.
+	Link     string
+	SelfLink string
+	Author   string
+	Updated  time.Time
+	Items    []Item
+}
+
+type Item struct {
+	ID         string
+	Title      string
+	Link       string
+	Published  time.Time
+	Updated    time.Time
+	Author     string
+	Categories []string
+	// Summary and Content are HTML.
+	Summary     string
+	Content     string
+	CommentsURL string
+	Enclosures  []Enclosure
+}
+
+type Enclosure struct {
+	URL             string
+	Type            string
+	Length          int64
+	DurationSeconds int
+}
+
+// Write renders feed to w in the given format.
+func Write(w io.Writer, format Format, feed Feed) error {
+	switch format {
+	case Atom:
+		return writeXML(w, atomFeed(feed))
+	case RSS:
+		if feed.Link == "" && feed.SelfLink == "" {
+			return ErrNoLink
+		}
+		return writeXML(w, rssFeed(feed))
+	case JSONFeed:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(jsonFeed(feed))
+	}
+	return fmt.Errorf("unknown feed format %q", format)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type atomDoc struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   *atomPerson `xml:"author,omitempty"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Author     *atomPerson    `xml:"author,omitempty"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+func atomFeed(feed Feed) atomDoc {
+	doc := atomDoc{
+		ID:       feed.ID,
+		Title:    feed.Title,
+		Subtitle: feed.Description,
+		Updated:  feed.Updated.UTC().Format(time.RFC3339),
+	}
+	if feed.Author != "" {
+		doc.Author = &atomPerson{Name: feed.Author}
+	}
+	if feed.Link != "" {
+		doc.Links = append(doc.Links, atomLink{Rel: "alternate", Href: feed.Link})
+	}
+	if feed.SelfLink != "" {
+		doc.Links = append(doc.Links, atomLink{Rel: "self", Href: feed.SelfLink})
+	}
+
+	for _, item := range feed.Items {
+		entry := atomEntry{
+			ID:      item.ID,
+			Title:   item.Title,
+			Updated: item.Updated.UTC().Format(time.RFC3339),
+		}
+		if !item.Published.IsZero() {
+			entry.Published = item.Published.UTC().Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			entry.Author = &atomPerson{Name: item.Author}
+		}
+		if item.Link != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "alternate", Href: item.Link})
+		}
+		if item.CommentsURL != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "replies", Href: item.CommentsURL, Type: "text/html"})
+		}
+		for _, e := range item.Enclosures {
+			entry.Links = append(entry.Links, atomLink{Rel: "enclosure", Href: e.URL, Type: e.Type, Length: e.Length})
+		}
+		for _, category := range item.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: category})
+		}
+		if item.Summary != "" {
+			entry.Summary = &atomText{Type: "html", Body: item.Summary}
+		}
+		if item.Content != "" {
+			entry.Content = &atomText{Type: "html", Body: item.Content}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return doc
+}
+
+type rssDoc struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	DCNS      string     `xml:"xmlns:dc,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	LastBuildDate string      `xml:"lastBuildDate"`
+	Self          *rssAtomRef `xml:"atom:link,omitempty"`
+	Items         []rssItem   `xml:"item"`
+}
+
+type rssAtomRef struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Creator     string        `xml:"dc:creator,omitempty"`
+	Categories  []string      `xml:"category"`
+	Comments    string        `xml:"comments,omitempty"`
+	Description string        `xml:"description,omitempty"`
+	Content     string        `xml:"content:encoded,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+func rssFeed(feed Feed) rssDoc {
+	description := feed.Description
+	if description == "" {
+		description = feed.Title
+	}
+	doc := rssDoc{
+		Version:   "2.0",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		DCNS:      "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         feed.Title,
+			Link:          feed.Link,
+			Description:   description,
+			LastBuildDate: feed.Updated.UTC().Format(time.RFC1123Z),
+		},
+	}
+	if doc.Channel.Link == "" {
+		doc.Channel.Link = feed.SelfLink
+	}
+	if feed.SelfLink != "" {
+		doc.Channel.Self = &rssAtomRef{Rel: "self", Href: feed.SelfLink, Type: "application/rss+xml"}
+	}
+
+	for _, item := range feed.Items {
+		ri := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{Value: item.ID},
+			Creator:     item.Author,
+			Categories:  item.Categories,
+			Comments:    item.CommentsURL,
+			Description: item.Summary,
+			Content:     item.Content,
+		}
+		if !item.Published.IsZero() {
+			ri.PubDate = item.Published.UTC().Format(time.RFC1123Z)
+		}
+		// RSS allows a single enclosure per item.
+		if len(item.Enclosures) > 0 {
+			e := item.Enclosures[0]
+			ri.Enclosure = &rssEnclosure{URL: e.URL, Length: e.Length, Type: e.Type}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, ri)
+	}
+	return doc
+}
+
+type jsonFeedDoc struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	ContentHTML   string               `json:"content_html"`
+	DatePublished string               `json:"date_published,omitempty"`
+	DateModified  string               `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Tags          []string             `json:"tags,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedAttachment struct {
+	URL               string `json:"url"`
+	MimeType          string `json:"mime_type"`
+	SizeInBytes       int64  `json:"size_in_bytes,omitempty"`
+	DurationInSeconds int    `json:"duration_in_seconds,omitempty"`
+}
+
+func jsonFeed(feed Feed) jsonFeedDoc {
+	doc := jsonFeedDoc{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: feed.Link,
+		FeedURL:     feed.SelfLink,
+		Description: feed.Description,
+		Items:       []jsonFeedItem{},
+	}
+	if feed.Author != "" {
+		doc.Authors = []jsonFeedAuthor{{Name: feed.Author}}
+	}
+
+	for _, item := range feed.Items {
+		ji := jsonFeedItem{
+			ID:           item.ID,
+			URL:          item.Link,
+			Title:        item.Title,
+			ContentHTML:  item.Content,
+			DateModified: item.Updated.UTC().Format(time.RFC3339),
+			Tags:         item.Categories,
+		}
+		if ji.ContentHTML == "" {
+			ji.ContentHTML = item.Summary
+		}
+		if !item.Published.IsZero() {
+			ji.DatePublished = item.Published.UTC().Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			ji.Authors = []jsonFeedAuthor{{Name: item.Author}}
+		}
+		for _, e := range item.Enclosures {
+			mimeType := e.Type
+			if mimeType == "" {
+				mimeType = "application/octet-stream"
+			}
+			ji.Attachments = append(ji.Attachments, jsonFeedAttachment{
+				URL:               e.URL,
+				MimeType:          mimeType,
+				SizeInBytes:       e.Length,
+				DurationInSeconds: e.DurationSeconds,
+			})
+		}
+		doc.Items = append(doc.Items, ji)
+	}
+	return doc
+}
@@ -0,0 +1,69 @@
+package publish
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWriteRSSChannelLink(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     string
+		selfLink string
+		want     string
+	}{
+		{"link", "https://gator.example.com/", "https://gator.example.com/users/alice/feed.rss", "https://gator.example.com/"},
+		{"self link only", "", "https://gator.example.com/users/alice/feed.rss", "https://gator.example.com/users/alice/feed.rss"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := Feed{Title: "timeline", Link: tt.link, SelfLink: tt.selfLink, Updated: time.Now()}
+			var buf bytes.Buffer
+			if err := Write(&buf, RSS, feed); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			var doc struct {
+				Channel struct {
+					// Links also holds <atom:link rel="self">.
+					Links []struct {
+						XMLName xml.Name
+						Value   string `xml:",chardata"`
+					} `xml:"link"`
+				} `xml:"channel"`
+			}
+			if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+				t.Fatalf("couldn't parse output: %v\n%s", err, buf.String())
+			}
+			var link string
+			for _, l := range doc.Channel.Links {
+				if l.XMLName.Space == "" {
+					link = l.Value
+				}
+			}
+			if link != tt.want {
+				t.Errorf("channel link = %q, want %q", link, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteRSSWithoutLink(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, RSS, Feed{Title: "timeline", Updated: time.Now()})
+	if !errors.Is(err, ErrNoLink) {
+		t.Fatalf("err = %v, want ErrNoLink", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %q, want nothing", buf.String())
+	}
+}
+
+func TestWriteAtomWithoutLink(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, Atom, Feed{Title: "timeline", Updated: time.Now()}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
@@ -0,0 +1,421 @@
+// Package render converts the HTML found in feed descriptions into wrapped
+// text suitable for a terminal.
+package render
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const DefaultWidth = 80
+
+type Options struct {
+	// Width is the column at which text is wrapped. Zero means DefaultWidth.
+	Width int
+	// Color styles emphasis, headings and links with ANSI escape codes.
+	// Without it emphasis is marked up with asterisks and underscores.
+	Color bool
+}
+
+type style struct {
+	bold    bool
+	italic  bool
+	link    bool
+	code    bool
+	heading bool
+}
+
+type word struct {
+	text  string
+	style style
+	// glue joins the word to the previous one without a space.
+	glue bool
+}
+
+// prefix is a line prefix contributed by an enclosing block, such as a list
+// bullet or a quote bar. first is used on the first line of the block.
+type prefix struct {
+	first string
+	rest  string
+	used  bool
+}
+
+type renderer struct {
+	opts  Options
+	out   strings.Builder
+	words []word
+	stack []*prefix
+	style style
+	links []string
+
+	// space records whether whitespace was seen since the last word.
+	space bool
+	// blank requests an empty line before the next block.
+	blank bool
+	// pending holds plain-text emphasis markers for the next word.
+	pending string
+	lists   []int
+}
+
+// HTML renders src as terminal text. Input that is not valid HTML is
+// rendered on a best effort basis, like a browser would.
+func HTML(src string, opts Options) string {
+	if opts.Width <= 0 {
+		opts.Width = DefaultWidth
+	}
+
+	nodes, err := html.ParseFragment(strings.NewReader(src), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return stripControls(src)
+	}
+
+	r := &renderer{opts: opts}
+	for _, n := range nodes {
+		r.node(n)
+	}
+	r.flush()
+
+	if len(r.links) > 0 {
+		r.out.WriteString("\n")
+		for i, link := range r.links {
+			fmt.Fprintf(&r.out, "[%d] %s\n", i+1, link)
+		}
+	}
+	return strings.TrimRight(r.out.String(), "\n")
+}
+
+func (r *renderer) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		r.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Noscript, atom.Template, atom.Iframe, atom.Object:
+		return
+	case atom.Br:
+		r.flush()
+	case atom.Hr:
+		r.block()
+		r.line(strings.Repeat("─", max(r.opts.Width-r.prefixWidth(), 1)))
+		r.blank = true
+	case atom.Img:
+		alt := strings.TrimSpace(attr(n, "alt"))
+		if alt == "" {
+			r.text("[image]")
+		} else {
+			r.text("[image: " + alt + "]")
+		}
+	case atom.A:
+		r.link(n)
+	case atom.B, atom.Strong:
+		r.inline(n, "**", func(s *style) { s.bold = true })
+	case atom.I, atom.Em, atom.Cite:
+		r.inline(n, "_", func(s *style) { s.italic = true })
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		r.inline(n, "`", func(s *style) { s.code = true })
+	case atom.Pre:
+		r.pre(n)
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.block()
+		saved := r.style
+		r.style.heading = true
+		r.style.bold = true
+		r.children(n)
+		r.style = saved
+		r.flush()
+		r.blank = true
+	case atom.Ul, atom.Ol:
+		r.block()
+		r.lists = append(r.lists, 0)
+		if n.DataAtom == atom.Ul {
+			r.lists[len(r.lists)-1] = -1
+		}
+		r.children(n)
+		r.lists = r.lists[:len(r.lists)-1]
+		r.flush()
+		r.blank = true
+	case atom.Li:
+		r.listItem(n)
+	case atom.Blockquote:
+		r.block()
+		r.stack = append(r.stack, &prefix{first: "│ ", rest: "│ "})
+		r.children(n)
+		r.flush()
+		r.stack = r.stack[:len(r.stack)-1]
+		r.blank = true
+	case atom.Td, atom.Th:
+		if r.words != nil {
+			r.words = append(r.words, word{text: "|", style: r.style})
+		}
+		r.children(n)
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer,
+		atom.Figure, atom.Figcaption, atom.Table, atom.Tr, atom.Dl, atom.Dt, atom.Dd,
+		atom.Aside, atom.Details, atom.Summary, atom.Main, atom.Nav, atom.Address:
+		r.block()
+		r.children(n)
+		r.flush()
+		r.blank = true
+	default:
+		r.children(n)
+	}
+}
+
+func (r *renderer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.node(c)
+	}
+}
+
+// inline renders an emphasised run. In plain mode the marker is wrapped
+// around the whole run rather than each word.
+func (r *renderer) inline(n *html.Node, marker string, apply func(*style)) {
+	saved := r.style
+	apply(&r.style)
+	start := len(r.words)
+	if !r.opts.Color {
+		r.pending += marker
+	}
+	r.children(n)
+	if !r.opts.Color {
+		if len(r.words) > start {
+			r.words[len(r.words)-1].text += marker
+		} else {
+			r.pending = strings.TrimSuffix(r.pending, marker)
+		}
+	}
+	r.style = saved
+}
+
+func (r *renderer) link(n *html.Node) {
+	href := stripControls(strings.TrimSpace(attr(n, "href")))
+	saved := r.style
+	r.style.link = true
+	start := len(r.words)
+	r.children(n)
+	r.style = saved
+
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return
+	}
+	if len(r.words) == start {
+		r.text(href)
+		return
+	}
+	if len(r.words) == start+1 && r.words[start].text == href {
+		return
+	}
+
+	index := -1
+	for i, link := range r.links {
+		if link == href {
+			index = i
+		}
+	}
+	if index < 0 {
+		r.links = append(r.links, href)
+		index = len(r.links) - 1
+	}
+	r.words = append(r.words, word{text: fmt.Sprintf("[%d]", index+1), glue: true})
+	r.space = false
+}
+
+func (r *renderer) listItem(n *html.Node) {
+	r.flush()
+	marker := "• "
+	if depth := len(r.lists); depth > 0 && r.lists[depth-1] >= 0 {
+		r.lists[depth-1]++
+		marker = fmt.Sprintf("%d. ", r.lists[depth-1])
+	}
+	r.stack = append(r.stack, &prefix{first: marker, rest: strings.Repeat(" ", utf8.RuneCountInString(marker))})
+	r.blank = false
+	r.children(n)
+	r.flush()
+	r.stack = r.stack[:len(r.stack)-1]
+	r.blank = false
+}
+
+// pre writes preformatted text verbatim, indented and without wrapping.
+func (r *renderer) pre(n *html.Node) {
+	r.block()
+	text := strings.Trim(textContent(n), "\n")
+	for _, line := range strings.Split(text, "\n") {
+		r.line("    " + r.styled(stripControls(strings.TrimRight(line, " \t\r")), style{code: true}))
+	}
+	r.blank = true
+}
+
+func (r *renderer) text(s string) {
+	if s == "" {
+		return
+	}
+	if startsWithSpace(s) {
+		r.space = true
+	}
+	for _, field := range strings.Fields(s) {
+		if field = stripControls(field); field == "" {
+			continue
+		}
+		r.words = append(r.words, word{
+			text:  r.pending + field,
+			style: r.style,
+			glue:  !r.space && len(r.words) > 0,
+		})
+		r.pending = ""
+		r.space = true
+	}
+	r.space = endsWithSpace(s)
+}
+
+// block starts a new block, separating it from the previous one.
+func (r *renderer) block() {
+	r.flush()
+	if r.blank && r.out.Len() > 0 {
+		r.line("")
+	}
+	r.blank = false
+}
+
+// flush wraps the pending words into lines.
+func (r *renderer) flush() {
+	if len(r.words) == 0 {
+		r.space = false
+		return
+	}
+	if r.blank && r.out.Len() > 0 {
+		r.line("")
+	}
+	r.blank = false
+
+	width := max(r.opts.Width-r.prefixWidth(), 10)
+	var line strings.Builder
+	lineWidth := 0
+	for _, w := range r.words {
+		n := utf8.RuneCountInString(w.text)
+		if lineWidth > 0 && !w.glue && lineWidth+1+n > width {
+			r.line(line.String())
+			line.Reset()
+			lineWidth = 0
+		}
+		if lineWidth > 0 && !w.glue {
+			line.WriteByte(' ')
+			lineWidth++
+		}
+		line.WriteString(r.styled(w.text, w.style))
+		lineWidth += n
+	}
+	r.line(line.String())
+
+	r.words = nil
+	r.space = false
+	r.pending = ""
+}
+
+func (r *renderer) line(s string) {
+	var b strings.Builder
+	for _, p := range r.stack {
+		if p.used {
+			b.WriteString(p.rest)
+		} else {
+			b.WriteString(p.first)
+			p.used = true
+		}
+	}
+	b.WriteString(s)
+	r.out.WriteString(strings.TrimRight(b.String(), " "))
+	r.out.WriteByte('\n')
+}
+
+func (r *renderer) prefixWidth() int {
+	width := 0
+	for _, p := range r.stack {
+		width += utf8.RuneCountInString(p.rest)
+	}
+	return width
+}
+
+func (r *renderer) styled(text string, s style) string {
+	if !r.opts.Color || text == "" {
+		return text
+	}
+
+	var codes []string
+	if s.bold {
+		codes = append(codes, "1")
+	}
+	if s.italic {
+		codes = append(codes, "3")
+	}
+	if s.link {
+		codes = append(codes, "4", "34")
+	}
+	if s.code {
+		codes = append(codes, "33")
+	}
+	if s.heading {
+		codes = append(codes, "36")
+	}
+	if len(codes) == 0 {
+		return text
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m" + text + "\x1b[0m"
+}
+
+// stripControls removes the C0 controls but tab and newline, DEL and the C1
+// controls. Feed text is untrusted, and escape sequences in it would
+// otherwise reach the terminal.
+func stripControls(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t', r == '\n':
+			return r
+		case r < 0x20, r >= 0x7f && r < 0xa0:
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	if n.Type == html.ElementNode && n.DataAtom == atom.Br {
+		return "\n"
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func startsWithSpace(s string) bool {
+	return strings.TrimLeft(s, " \t\r\n\f") != s
+}
+
+func endsWithSpace(s string) bool {
+	return strings.TrimRight(s, " \t\r\n\f") != s
+}
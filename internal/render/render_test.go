@@ -0,0 +1,92 @@
+package render
+
+import "testing"
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		color bool
+		want  string
+	}{
+		{
+			"wraps at the width",
+			`<p>The quick brown fox jumps over the lazy dog and keeps running far away</p>`,
+			false,
+			"The quick brown fox\njumps over the lazy\ndog and keeps\nrunning far away",
+		},
+		{
+			"paragraphs are separated by a blank line",
+			`<p>one</p><p>two</p>`,
+			false,
+			"one\n\ntwo",
+		},
+		{
+			"lists",
+			`<ul><li>one</li><li>two <b>bold</b></li></ul><ol><li>first</li><li>second</li></ol>`,
+			false,
+			"• one\n• two **bold**\n\n1. first\n2. second",
+		},
+		{
+			"list items wrap under their text",
+			`<ul><li>a long item that has to wrap onto the next line here</li></ul>`,
+			false,
+			"• a long item that\n  has to wrap onto\n  the next line here",
+		},
+		{
+			"links become footnotes",
+			`<p>See <a href="https://example.com/a">this</a> and <a href="https://example.com/b">that</a>, again <a href="https://example.com/a">this</a>.</p>`,
+			false,
+			"See this[1] and that[2],\nagain this[1].\n\n[1] https://example.com/a\n[2] https://example.com/b",
+		},
+		{
+			"links without a footnote",
+			`<a href="https://example.com/c">https://example.com/c</a> <a href="#top">top</a> <a href="javascript:alert(1)">js</a> <a href="https://example.com/d"></a>`,
+			false,
+			"https://example.com/c\ntop js\nhttps://example.com/d",
+		},
+		{
+			"colored link",
+			`<a href="https://example.com/a">this</a>`,
+			true,
+			"\x1b[4;34mthis\x1b[0m[1]\n\n[1] https://example.com/a",
+		},
+		{
+			"pre is kept verbatim",
+			"<pre>func main() {\n\tfmt.Println(\"a long line that is not wrapped\")   \n}</pre><p>after</p>",
+			false,
+			"    func main() {\n    \tfmt.Println(\"a long line that is not wrapped\")\n    }\n\nafter",
+		},
+		{
+			"entities are decoded",
+			`<p>Tom &amp; Jerry &lt;3 caf&eacute;</p>`,
+			false,
+			"Tom & Jerry <3 café",
+		},
+		{
+			"control characters are stripped",
+			"<p>a\x1b[2Jb&#x1b;]0;title&#7; c\u0085\u009bd</p>",
+			false,
+			"a[2Jb]0;title c d",
+		},
+		{
+			"control characters are stripped from pre",
+			"<pre>\x1b[31mred\x1b[0m\r</pre>",
+			true,
+			"    \x1b[33m[31mred[0m\x1b[0m",
+		},
+		{
+			"control characters are stripped from alt text and links",
+			`<img alt="a&#27;[1mb"><a href="https://example.com/&#27;[2J">x</a> <a href="java&#1;script:alert(1)">js</a>`,
+			false,
+			"[image: a[1mb]x[1]\njs\n\n[1] https://example.com/[2J",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTML(tt.src, Options{Width: 20, Color: tt.color}); got != tt.want {
+				t.Errorf("HTML(%q) =\n%q\nwant\n%q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+// Package sanitize cleans the HTML of feed items before it is stored, so
+// that anything rendering post content can trust it.
+package sanitize
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowed maps each tag that is kept to the attributes it may carry.
+// Tags missing from the map are unwrapped: their content is kept.
+var allowed = map[atom.Atom][]string{
+	atom.A:          {"href", "title"},
+	atom.Abbr:       {"title"},
+	atom.B:          nil,
+	atom.Blockquote: {"cite"},
+	atom.Br:         nil,
+	atom.Caption:    nil,
+	atom.Cite:       nil,
+	atom.Code:       nil,
+	atom.Dd:         nil,
+	atom.Del:        {"cite", "datetime"},
+	atom.Details:    nil,
+	atom.Dfn:        nil,
+	atom.Div:        nil,
+	atom.Dl:         nil,
+	atom.Dt:         nil,
+	atom.Em:         nil,
+	atom.Figcaption: nil,
+	atom.Figure:     nil,
+	atom.H1:         nil,
+	atom.H2:         nil,
+	atom.H3:         nil,
+	atom.H4:         nil,
+	atom.H5:         nil,
+	atom.H6:         nil,
+	atom.Hr:         nil,
+	atom.I:          nil,
+	atom.Img:        {"src", "alt", "title", "width", "height"},
+	atom.Ins:        {"cite", "datetime"},
+	atom.Kbd:        nil,
+	atom.Li:         nil,
+	atom.Mark:       nil,
+	atom.Ol:         {"start", "reversed"},
+	atom.P:          nil,
+	atom.Pre:        nil,
+	atom.Q:          {"cite"},
+	atom.S:          nil,
+	atom.Samp:       nil,
+	atom.Small:      nil,
+	atom.Span:       nil,
+	atom.Strike:     nil,
+	atom.Strong:     nil,
+	atom.Sub:        nil,
+	atom.Summary:    nil,
+	atom.Sup:        nil,
+	atom.Table:      nil,
+	atom.Tbody:      nil,
+	atom.Td:         {"colspan", "rowspan"},
+	atom.Tfoot:      nil,
+	atom.Th:         {"colspan", "rowspan", "scope"},
+	atom.Thead:      nil,
+	atom.Time:       {"datetime"},
+	atom.Tr:         nil,
+	atom.U:          nil,
+	atom.Ul:         nil,
+}
+
+// dropped lists the tags that are removed along with their content.
+var dropped = map[atom.Atom]bool{
+	atom.Applet:   true,
+	atom.Base:     true,
+	atom.Button:   true,
+	atom.Embed:    true,
+	atom.Form:     true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Head:     true,
+	atom.Iframe:   true,
+	atom.Input:    true,
+	atom.Link:     true,
+	atom.Math:     true,
+	atom.Meta:     true,
+	atom.Noscript: true,
+	atom.Object:   true,
+	atom.Script:   true,
+	atom.Select:   true,
+	atom.Style:    true,
+	atom.Svg:      true,
+	atom.Template: true,
+	atom.Textarea: true,
+	atom.Title:    true,
+}
+
+// urlAttrs are the attributes holding URLs, which are resolved against the
+// item link and restricted to safe schemes.
+var urlAttrs = map[string]bool{
+	"href": true,
+	"src":  true,
+	"cite": true,
+}
+
+var safeSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// trackers are hosts, optionally followed by a path prefix, that only serve
+// tracking pixels and share buttons.
+var trackers = []string{
+	"feeds.feedburner.com/~r/",
+	"feeds.feedburner.com/~ff/",
+	"feedads.g.doubleclick.net",
+	"ad.doubleclick.net",
+	"pixel.wp.com",
+	"stats.wordpress.com",
+	"feeds.wordpress.com/1.0/",
+	"www.google-analytics.com",
+	"pixel.quantserve.com",
+	"b.scorecardresearch.com",
+	"medium.com/_/stat",
+	"eotrx.substackcdn.com",
+}
+
+// HTML returns src with everything outside the allowlist removed. Relative
+// links and image sources are resolved against base, usually the item link.
+func HTML(src, base string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil || !baseURL.IsAbs() {
+		baseURL = nil
+	}
+
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(src), body)
+	if err != nil {
+		return html.EscapeString(src)
+	}
+
+	var b strings.Builder
+	for _, n := range nodes {
+		for _, clean := range cleanNode(n, baseURL) {
+			if err := html.Render(&b, clean); err != nil {
+				return html.EscapeString(src)
+			}
+		}
+	}
+	return b.String()
+}
+
+// inline lists the tags that don't separate words, so that text split by
+// them is joined back together by Text.
+var inline = map[atom.Atom]bool{
+	atom.A:      true,
+	atom.Abbr:   true,
+	atom.B:      true,
+	atom.Cite:   true,
+	atom.Code:   true,
+	atom.Del:    true,
+	atom.Dfn:    true,
+	atom.Em:     true,
+	atom.I:      true,
+	atom.Ins:    true,
+	atom.Kbd:    true,
+	atom.Mark:   true,
+	atom.Q:      true,
+	atom.S:      true,
+	atom.Samp:   true,
+	atom.Small:  true,
+	atom.Span:   true,
+	atom.Strike: true,
+	atom.Strong: true,
+	atom.Sub:    true,
+	atom.Sup:    true,
+	atom.Time:   true,
+	atom.U:      true,
+}
+
+// Text returns the readable text of src, without tags, attributes or the
+// content of dropped tags, with entities decoded and runs of whitespace
+// collapsed to single spaces.
+func Text(src string) string {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(src), body)
+	if err != nil {
+		return strings.Join(strings.Fields(src), " ")
+	}
+
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case n.Type == html.ElementNode && dropped[n.DataAtom]:
+			return
+		}
+		separate := n.Type == html.ElementNode && !inline[n.DataAtom]
+		if separate {
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if separate {
+			b.WriteByte(' ')
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// cleanNode returns the sanitized replacement for n, which may be nothing,
+// n itself or, for unwrapped elements, its cleaned children.
+func cleanNode(n *html.Node, base *url.URL) []*html.Node {
+	switch n.Type {
+	case html.TextNode:
+		return []*html.Node{{Type: html.TextNode, Data: n.Data}}
+	case html.ElementNode:
+	case html.DocumentNode:
+		return cleanChildren(n, base)
+	default:
+		return nil
+	}
+
+	if dropped[n.DataAtom] {
+		return nil
+	}
+	attrs, ok := allowed[n.DataAtom]
+	if !ok {
+		return cleanChildren(n, base)
+	}
+
+	clean := &html.Node{
+		Type:     html.ElementNode,
+		Data:     n.Data,
+		DataAtom: n.DataAtom,
+		Attr:     cleanAttrs(n.Attr, attrs, base),
+	}
+
+	switch n.DataAtom {
+	case atom.Img:
+		if isTrackingPixel(clean) {
+			return nil
+		}
+	case atom.A:
+		if hasAttr(clean, "href") {
+			clean.Attr = append(clean.Attr, html.Attribute{Key: "rel", Val: "nofollow noopener noreferrer"})
+		}
+	}
+
+	for _, child := range cleanChildren(n, base) {
+		clean.AppendChild(child)
+	}
+	if n.DataAtom == atom.A && clean.FirstChild == nil {
+		return nil
+	}
+	return []*html.Node{clean}
+}
+
+func cleanChildren(n *html.Node, base *url.URL) []*html.Node {
+	var children []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		children = append(children, cleanNode(c, base)...)
+	}
+	return children
+}
+
+func cleanAttrs(attrs []html.Attribute, keep []string, base *url.URL) []html.Attribute {
+	var clean []html.Attribute
+	for _, a := range attrs {
+		if a.Namespace != "" || !slices.Contains(keep, a.Key) {
+			continue
+		}
+		if urlAttrs[a.Key] {
+			resolved, ok := resolveURL(a.Val, base)
+			if !ok {
+				continue
+			}
+			a.Val = resolved
+		}
+		clean = append(clean, html.Attribute{Key: a.Key, Val: a.Val})
+	}
+	return clean
+}
+
+// resolveURL makes raw absolute against base and reports whether the result
+// uses a safe scheme.
+func resolveURL(raw string, base *url.URL) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", false
+	}
+	if !u.IsAbs() {
+		if base == nil {
+			return "", false
+		}
+		u = base.ResolveReference(u)
+	}
+	if !safeSchemes[strings.ToLower(u.Scheme)] {
+		return "", false
+	}
+	return u.String(), true
+}
+
+func isTrackingPixel(img *html.Node) bool {
+	src := attrValue(img, "src")
+	if src == "" {
+		return true
+	}
+	if isTiny(attrValue(img, "width")) || isTiny(attrValue(img, "height")) {
+		return true
+	}
+
+	u, err := url.Parse(src)
+	if err != nil {
+		return true
+	}
+	target := strings.ToLower(u.Host) + u.Path
+	for _, tracker := range trackers {
+		if strings.HasPrefix(target, tracker) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTiny(dimension string) bool {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(dimension), "px"))
+	return err == nil && n <= 1
+}
+
+func attrValue(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
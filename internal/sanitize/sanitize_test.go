@@ -0,0 +1,86 @@
+package sanitize
+
+import "testing"
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"plain", "Hello, world", "Hello, world"},
+		{"markup is not text", `<div class="post"><a href="https://example.com/">a link</a></div>`, "a link"},
+		{"entities are decoded", "Tom &amp; Jerry &lt;3", "Tom & Jerry <3"},
+		{"inline tags join words", "<b>Go</b>pher", "Gopher"},
+		{"blocks separate words", "<p>one</p><p>two</p>two<br>three", "one two two three"},
+		{"dropped tags lose their content", "before<script>alert('href')</script>after", "beforeafter"},
+		{"whitespace is collapsed", "  a\n\n\tb  ", "a b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Text(tt.src); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTML(t *testing.T) {
+	const base = "https://example.com/posts/1"
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"allowed markup is kept", `<p>Hello <em>world</em></p>`, `<p>Hello <em>world</em></p>`},
+		{"unknown tags are unwrapped", `<section><font color="red">text</font></section>`, `text`},
+		{"script is dropped", `a<script>alert(1)</script>b`, `ab`},
+		{"upper-case script is dropped", `a<SCRIPT SRC="https://evil.example/x.js"></SCRIPT>b`, `ab`},
+		{"style is dropped", `<style>body{display:none}</style><p>text</p>`, `<p>text</p>`},
+		{"iframe is dropped", `<iframe src="https://evil.example/"></iframe><p>text</p>`, `<p>text</p>`},
+		{"event handlers are dropped", `<p onclick="alert(1)" ONMOUSEOVER="alert(2)">text</p>`, `<p>text</p>`},
+		{"event handlers on images are dropped", `<img src="https://example.com/a.png" onerror="alert(1)">`, `<img src="https://example.com/a.png"/>`},
+		{"style and class are dropped", `<span style="color:red" class="x">text</span>`, `<span>text</span>`},
+		{"http link", `<a href="https://example.com/">x</a>`, `<a href="https://example.com/" rel="nofollow noopener noreferrer">x</a>`},
+		{"mailto link", `<a href="mailto:jane@example.com">x</a>`, `<a href="mailto:jane@example.com" rel="nofollow noopener noreferrer">x</a>`},
+		{"javascript href", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"mixed case javascript href", `<a href="JaVaScRiPt:alert(1)">x</a>`, `<a>x</a>`},
+		{"padded javascript href", `<a href="  javascript:alert(1)  ">x</a>`, `<a>x</a>`},
+		{"javascript href split by a tab", "<a href=\"java\tscript:alert(1)\">x</a>", `<a>x</a>`},
+		{"javascript href split by a newline entity", `<a href="java&#x0A;script:alert(1)">x</a>`, `<a>x</a>`},
+		{"javascript href with a leading control character", `<a href="&#1;javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"entity encoded javascript href", `<a href="&#106;&#97;vascript&colon;alert(1)">x</a>`, `<a>x</a>`},
+		{"data href", `<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">x</a>`, `<a>x</a>`},
+		{"data image", `<img src="DATA:image/svg+xml,&lt;svg onload=alert(1)&gt;" width="10">`, ``},
+		{"vbscript href", `<a href="VBScript:MsgBox(1)">x</a>`, `<a>x</a>`},
+		{"relative link", `<a href="../2">next</a>`, `<a href="https://example.com/2" rel="nofollow noopener noreferrer">next</a>`},
+		{"root relative image", `<img src="/img/a.png" alt="A">`, `<img src="https://example.com/img/a.png" alt="A"/>`},
+		{"protocol relative image", `<img src="//cdn.example.com/a.png">`, `<img src="https://cdn.example.com/a.png"/>`},
+		{"relative cite", `<blockquote cite="/source">q</blockquote>`, `<blockquote cite="https://example.com/source">q</blockquote>`},
+		{"empty link is dropped", `<a href="https://example.com/"></a>text`, `text`},
+		{"one pixel image", `<img src="https://example.com/p.gif" width="1" height="1">`, ``},
+		{"one pixel image in px", `<img src="https://example.com/p.gif" width="1px">`, ``},
+		{"image without src", `<img alt="nothing">`, ``},
+		{"feedburner pixel", `<img src="https://feeds.feedburner.com/~r/example/~4/abc">`, ``},
+		{"wordpress stats pixel", `<img src="https://pixel.wp.com/b.gif?v=1">`, ``},
+		{"tracker host in upper case", `<img src="https://STATS.WordPress.com/g.gif">`, ``},
+		{"normal image on a tracker's site", `<img src="https://feeds.feedburner.com/logo.png">`, `<img src="https://feeds.feedburner.com/logo.png"/>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTML(tt.src, base); got != tt.want {
+				t.Errorf("HTML(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLWithoutBase(t *testing.T) {
+	src := `<a href="/relative">x</a><img src="a.png"><a href="https://example.com/">y</a>`
+	want := `<a>x</a><a href="https://example.com/" rel="nofollow noopener noreferrer">y</a>`
+	for _, base := range []string{"", "not a url", "/relative/base"} {
+		if got := HTML(src, base); got != want {
+			t.Errorf("HTML with base %q = %q, want %q", base, got, want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/zyaeger/gator/internal/config"
+)
+
+// newLogger builds the logger for operational messages, such as the
+// progress of agg and the requests handled by serve. format overrides the
+// format of cfg when it isn't empty.
+func newLogger(w io.Writer, cfg config.LogConfig, format string) (*slog.Logger, error) {
+	var level slog.Level
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q (expected debug, info, warn or error)", cfg.Level)
+		}
+	}
+	if format == "" {
+		format = cfg.Format
+	}
+	if format != "" {
+		if err := checkLogFormat(format); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	if strings.EqualFold(format, "json") {
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(w, opts)), nil
+}
+
+// checkLogFormat returns an error unless format is "text" or "json".
+func checkLogFormat(format string) error {
+	switch strings.ToLower(format) {
+	case "text", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown log format %q (expected text or json)", format)
+}
@@ -5,19 +5,60 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 
 	_ "github.com/lib/pq"
 	"github.com/zyaeger/gator/internal/config"
 	"github.com/zyaeger/gator/internal/database"
+	"github.com/zyaeger/gator/internal/output"
+	"github.com/zyaeger/gator/internal/secrets"
 )
 
 type state struct {
-	db  *database.Queries
-	cfg *config.Config
+	db      *database.Queries
+	sqlDB   *sql.DB
+	cfg     *config.Config
+	fetcher *fetcher
+	secrets *secrets.Box
+	format  output.Format
 }
 
 func main() {
+	cmds := commands{
+		cmdToHandler: make(map[string]func(*state, command) error),
+	}
+	cmds.register("login", handlerLogin)
+	cmds.register("register", handlerRegister)
+	cmds.register("reset", handlerReset)
+	cmds.register("users", handlerUsers)
+	cmds.register("passwd", middlewareLoggedIn(handlerPasswd))
+	cmds.register("agg", handlerAgg)
+	cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed))
+	cmds.register("feeds", handlerGetFeeds)
+	cmds.register("history", handlerHistory)
+	cmds.register("follow", middlewareLoggedIn(handlerFollow))
+	cmds.register("following", middlewareLoggedIn(handlerFollowing))
+	cmds.register("unfollow", middlewareLoggedIn(handlerUnfollow))
+	cmds.register("browse", middlewareLoggedIn(handlerBrowse))
+	cmds.register("publish", middlewareLoggedIn(handlerPublish))
+	cmds.register("tui", middlewareLoggedIn(handlerTUI))
+	cmds.register("download", handlerDownload)
+	cmds.register("serve", handlerServe)
+	cmds.register("token", middlewareLoggedIn(handlerToken))
+	cmds.register("webhook", middlewareLoggedIn(handlerWebhook))
+
+	// The command line is checked first, so that a mistake in it isn't
+	// hidden by a config or database error.
+	opts, cliArgs, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		log.Fatalf("%v\n%s", err, cmds.usage())
+	}
+	if len(cliArgs) < 1 {
+		fmt.Fprintln(os.Stderr, cmds.usage())
+		os.Exit(1)
+	}
+
 	cfg, err := config.Read()
 	if err != nil {
 		log.Fatalf("error reading config: %v", err)
@@ -30,34 +71,34 @@ func main() {
 	defer db.Close()
 	dbQueries := database.New(db)
 
-	programState := state{
-		db:  dbQueries,
-		cfg: &cfg,
+	feedFetcher, err := newFetcher(cfg.Fetch)
+	if err != nil {
+		log.Fatalf("error configuring fetcher: %v", err)
 	}
 
-	cmds := commands{
-		cmdToHandler: make(map[string]func(*state, command) error),
+	secretBox, err := loadSecretBox(cfg)
+	if err != nil {
+		log.Fatalf("error loading secret key: %v", err)
 	}
-	cmds.register("login", handlerLogin)
-	cmds.register("register", handlerRegister)
-	cmds.register("reset", handlerReset)
-	cmds.register("users", handlerUsers)
-	cmds.register("agg", handlerAgg)
-	cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed))
-	cmds.register("feeds", handlerGetFeeds)
-	cmds.register("follow", middlewareLoggedIn(handlerFollow))
-	cmds.register("following", middlewareLoggedIn(handlerFollowing))
-	cmds.register("unfollow", middlewareLoggedIn(handlerUnfollow))
-	cmds.register("browse", middlewareLoggedIn(handlerBrowse))
 
-	cliArgs := os.Args
-	if len(cliArgs) < 2 {
-		log.Fatalf("At least 2 arguments must be given")
+	programState := state{
+		db:      dbQueries,
+		sqlDB:   db,
+		cfg:     &cfg,
+		fetcher: feedFetcher,
+		secrets: secretBox,
+		format:  opts.output,
+	}
+
+	logger, err := newLogger(os.Stderr, cfg.Log, opts.logFormat)
+	if err != nil {
+		log.Fatal(err)
 	}
+	slog.SetDefault(logger)
 
 	cmd := command{
-		Name: cliArgs[1],
-		Args: cliArgs[2:],
+		Name: cliArgs[0],
+		Args: cliArgs[1:],
 	}
 
 	err = cmds.run(&programState, cmd)
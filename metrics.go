@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/zyaeger/gator/internal/metrics"
+)
+
+var (
+	registry = metrics.NewRegistry()
+
+	fetchesTotal = registry.NewCounter("gator_fetches_total",
+		"Feed collections by status, as shown by gator history, and HTTP response code.", "status", "code")
+	fetchDuration = registry.NewHistogram("gator_fetch_duration_seconds",
+		"Time from sending a feed request to having parsed the response.", metrics.DefBuckets)
+	fetchBytesTotal = registry.NewCounter("gator_fetch_bytes_total",
+		"Bytes of feed responses downloaded, before decompression.")
+	postsInsertedTotal = registry.NewCounter("gator_posts_inserted_total",
+		"Posts stored from collected or pushed feeds.")
+	postsDuplicateTotal = registry.NewCounter("gator_posts_duplicate_total",
+		"Feed items skipped because their post was already stored.")
+	parseErrorsTotal = registry.NewCounter("gator_parse_errors_total",
+		"Feeds that couldn't be parsed at all.")
+	parseWarningsTotal = registry.NewCounter("gator_parse_warnings_total",
+		"Problems the lenient feed parser recovered from.")
+	webhookDeliveriesTotal = registry.NewCounter("gator_webhook_deliveries_total",
+		"Webhook delivery attempts by outcome: delivered, retry or failed.", "result")
+	queueLag = registry.NewGauge("gator_queue_lag_seconds",
+		"Time since the next feed to collect was last collected, or added if it never was.")
+)
+
+// metricsHandler serves the registry, updating the queue lag first since
+// it comes from the database rather than from collections. The lag is
+// computed by the database so it is measured against the same clock that
+// recorded the last collection.
+func (s *state) metricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lag, err := s.db.GetQueueLag(r.Context())
+		switch {
+		case err == nil:
+			queueLag.Set(max(lag, 0))
+		case errors.Is(err, sql.ErrNoRows):
+			queueLag.Set(0)
+		default:
+			slog.Error("couldn't get next feed to collect", "error", err)
+		}
+		registry.Handler().ServeHTTP(w, r)
+	})
+}
+
+// countingReader counts the bytes read through it into fetchBytesTotal.
+type countingReader struct {
+	r io.Reader
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	fetchBytesTotal.Add(float64(n))
+	return n, err
+}
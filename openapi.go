@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// openAPISpec describes routes as an OpenAPI 3.1 document. Schemas are
+// derived from the request and response types by reflection, following
+// their json tags.
+func openAPISpec(routes []apiRoute) map[string]any {
+	errorResponse := map[string]any{
+		"description": "Error",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": jsonSchema(reflect.TypeFor[apiErrorBody]())},
+		},
+	}
+
+	paths := map[string]any{}
+	for _, route := range routes {
+		op := map[string]any{
+			"summary":     route.summary,
+			"operationId": operationID(route),
+		}
+
+		var params []any
+		for _, match := range pathParam.FindAllStringSubmatch(route.path, -1) {
+			params = append(params, map[string]any{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+		if route.paged {
+			params = append(params,
+				map[string]any{
+					"name":        "limit",
+					"in":          "query",
+					"description": "Number of items to return",
+					"schema":      map[string]any{"type": "integer", "minimum": 1, "maximum": maxPageSize, "default": defaultPageSize},
+				},
+				map[string]any{
+					"name":        "offset",
+					"in":          "query",
+					"description": "Number of items to skip",
+					"schema":      map[string]any{"type": "integer", "minimum": 0, "default": 0},
+				},
+			)
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		if route.request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": jsonSchema(reflect.TypeOf(route.request))},
+				},
+			}
+		}
+
+		responses := map[string]any{"default": errorResponse}
+		switch {
+		case route.response == nil:
+			responses["204"] = map[string]any{"description": "No Content"}
+		default:
+			status := http.StatusOK
+			if route.method == "POST" {
+				status = http.StatusCreated
+			}
+			responses[strconv.Itoa(status)] = map[string]any{
+				"description": http.StatusText(status),
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": jsonSchema(reflect.TypeOf(route.response))},
+				},
+			}
+		}
+		op["responses"] = responses
+
+		item, ok := paths[route.path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[route.path] = item
+		}
+		item[strings.ToLower(route.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "gator API",
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A token from `gator token create`",
+				},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []any{}}},
+	}
+}
+
+// operationID turns "GET /api/follows/{feed_id}" into "getFollowsFeedId".
+func operationID(route apiRoute) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(route.method))
+	for _, part := range strings.FieldsFunc(strings.TrimPrefix(route.path, "/api"), func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '_'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func jsonSchema(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[uuid.UUID]():
+		return map[string]any{"type": "string", "format": "uuid"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := jsonSchema(t.Elem())
+		schema["type"] = []any{schema["type"], "null"}
+		return schema
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		var required []string
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = jsonSchema(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": properties}
+		if required != nil {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]any{}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zyaeger/gator/internal/database"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+var errWrongPassword = errors.New("wrong password")
+
+// stdin is shared by every prompt so that passwords piped in one per line
+// are not lost to buffering.
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassword prompts on stderr and reads a password without echoing it.
+// When stdin is not a terminal, a line is read from it instead.
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("couldn't read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readNewPassword asks for a password twice. An empty password is allowed
+// only when optional is set.
+func readNewPassword(prompt string, optional bool) (string, error) {
+	password, err := readPassword(prompt)
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		if optional {
+			return "", nil
+		}
+		return "", errors.New("password can't be empty")
+	}
+	confirm, err := readPassword("Confirm password: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm != password {
+		return "", errors.New("passwords don't match")
+	}
+	return password, nil
+}
+
+func hashPassword(password string) (sql.NullString, error) {
+	if password == "" {
+		return sql.NullString{}, nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("couldn't hash password: %w", err)
+	}
+	return sql.NullString{String: string(hash), Valid: true}, nil
+}
+
+// checkPassword prompts for the password of user, if they have one.
+func checkPassword(user database.User) error {
+	if !user.HashedPassword.Valid {
+		return nil
+	}
+	password, err := readPassword(fmt.Sprintf("Password for %s: ", user.Name))
+	if err != nil {
+		return err
+	}
+	if !passwordMatches(user, password) {
+		return errWrongPassword
+	}
+	return nil
+}
+
+// passwordMatches reports whether password is the password of user. It is
+// false for users without one.
+func passwordMatches(user database.User, password string) bool {
+	if !user.HashedPassword.Valid {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.HashedPassword.String), []byte(password)) == nil
+}
+
+// handlerPasswd sets or changes the password of the logged-in user. The
+// current password is asked for first, if there is one.
+func handlerPasswd(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	remove := fs.Bool("remove", false, "remove the password instead of changing it")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil || len(args) != 0 {
+		return fmt.Errorf("usage: %s [--remove]", cmd.Name)
+	}
+
+	if err := checkPassword(user); err != nil {
+		return err
+	}
+
+	hashed := sql.NullString{}
+	if !*remove {
+		password, err := readNewPassword("New password: ", false)
+		if err != nil {
+			return err
+		}
+		if hashed, err = hashPassword(password); err != nil {
+			return err
+		}
+	}
+
+	err = s.db.SetUserPassword(context.Background(), database.SetUserPasswordParams{
+		ID:             user.ID,
+		HashedPassword: hashed,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't set password: %w", err)
+	}
+	if *remove {
+		fmt.Println("Password removed.")
+		return nil
+	}
+	fmt.Println("Password changed.")
+	return nil
+}
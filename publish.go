@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+	"github.com/zyaeger/gator/internal/publish"
+)
+
+const defaultPublishLimit = 50
+
+// publishRoutes maps the personal feed URLs served by "gator serve" to
+// their format.
+var publishRoutes = map[string]publish.Format{
+	"GET /users/{name}/feed.atom": publish.Atom,
+	"GET /users/{name}/feed.rss":  publish.RSS,
+	"GET /users/{name}/feed.json": publish.JSONFeed,
+}
+
+// handlerPublish writes the timeline of the logged-in user, as shown by
+// browse, as a feed document on stdout.
+func handlerPublish(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	format := fs.String("format", string(publish.Atom), "atom, rss or jsonfeed")
+	limit := fs.Int("limit", defaultPublishLimit, "number of posts to include")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil || len(args) != 0 || *limit <= 0 {
+		return fmt.Errorf("usage: %s [--format atom|rss|jsonfeed] [--limit N]", cmd.Name)
+	}
+	feedFormat, err := publish.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+	if feedFormat == publish.RSS && s.cfg.Serve.PublicURL == "" {
+		return errors.New("--format rss needs serve.public_url in the config, since RSS feeds must link to a web page")
+	}
+
+	feed, err := userFeed(context.Background(), s, user, feedFormat, *limit)
+	if err != nil {
+		return err
+	}
+	return publish.Write(os.Stdout, feedFormat, feed)
+}
+
+// userFeed builds the personal feed of user from their newest posts.
+func userFeed(ctx context.Context, s *state, user database.User, format publish.Format, limit int) (publish.Feed, error) {
+	posts, err := s.db.GetPostsForUser(ctx, database.GetPostsForUserParams{
+		UserID: user.ID,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		return publish.Feed{}, fmt.Errorf("couldn't get posts for user: %w", err)
+	}
+	postIDs := make([]uuid.UUID, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.ID
+	}
+	enclosures, err := postEnclosures(ctx, s, postIDs)
+	if err != nil {
+		return publish.Feed{}, fmt.Errorf("couldn't get enclosures: %w", err)
+	}
+
+	feed := publish.Feed{
+		ID:          "urn:uuid:" + user.ID.String(),
+		Title:       fmt.Sprintf("%s's gator timeline", user.Name),
+		Description: fmt.Sprintf("Posts from the feeds %s follows", user.Name),
+		Link:        s.webURL(),
+		SelfLink:    s.userFeedURL(user, format),
+		Author:      user.Name,
+		Updated:     user.CreatedAt,
+	}
+	for _, post := range posts {
+		item := publish.Item{
+			ID:          "urn:uuid:" + post.ID.String(),
+			Title:       post.Title,
+			Link:        post.Url,
+			Published:   post.PublishedAt.Time,
+			Updated:     post.UpdatedAt,
+			Author:      post.Author.String,
+			Categories:  post.Categories,
+			Summary:     post.Description.String,
+			Content:     post.Content.String,
+			CommentsURL: post.CommentsUrl.String,
+		}
+		if post.PublishedAt.Valid && post.PublishedAt.Time.After(item.Updated) {
+			item.Updated = post.PublishedAt.Time
+		}
+		if item.Updated.After(feed.Updated) {
+			feed.Updated = item.Updated
+		}
+		for _, e := range enclosures[post.ID] {
+			item.Enclosures = append(item.Enclosures, publish.Enclosure{
+				URL:             e.Url,
+				Type:            e.MimeType.String,
+				Length:          e.Length.Int64,
+				DurationSeconds: int(e.DurationSeconds.Int32),
+			})
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed, nil
+}
+
+// userFeedURL is where "gator serve" publishes the feed of user, or ""
+// when no public URL is configured.
+func (s *state) userFeedURL(user database.User, format publish.Format) string {
+	if s.cfg.Serve.PublicURL == "" {
+		return ""
+	}
+	for pattern, f := range publishRoutes {
+		if f == format {
+			_, path, _ := strings.Cut(pattern, " ")
+			path = strings.Replace(path, "{name}", url.PathEscape(user.Name), 1)
+			return strings.TrimRight(s.cfg.Serve.PublicURL, "/") + path
+		}
+	}
+	return ""
+}
+
+// webURL is the home page of the web UI of "gator serve", or "" when no
+// public URL is configured.
+func (s *state) webURL() string {
+	if s.cfg.Serve.PublicURL == "" {
+		return ""
+	}
+	return strings.TrimRight(s.cfg.Serve.PublicURL, "/") + "/"
+}
+
+// registerPublish serves the personal feeds. Feed readers often can't send
+// headers, so the API token may also be given as a "token" query parameter.
+func (s *state) registerPublish(mux *http.ServeMux) {
+	for pattern, format := range publishRoutes {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			s.servePersonalFeed(w, r, format)
+		})
+	}
+}
+
+func (s *state) servePersonalFeed(w http.ResponseWriter, r *http.Request, format publish.Format) {
+	var user database.User
+	var err error
+	if token := r.URL.Query().Get("token"); token != "" {
+		user, err = s.userForToken(r.Context(), token)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = &apiError{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "invalid or revoked token"}
+		}
+	} else {
+		user, err = s.apiUser(r)
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if user.Name != r.PathValue("name") {
+		writeAPIError(w, &apiError{Status: http.StatusForbidden, Code: "forbidden", Message: "the token belongs to another user"})
+		return
+	}
+
+	limit := defaultPublishLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			writeAPIError(w, badRequest("limit must be between 1 and %d", maxPageSize))
+			return
+		}
+	}
+
+	feed, err := userFeed(r.Context(), s, user, format, limit)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if feed.Link == "" {
+		// Without a public URL, link to where the request was sent so RSS
+		// still gets a channel link. The token is left out on purpose.
+		origin := "http://" + r.Host
+		if r.TLS != nil {
+			origin = "https://" + r.Host
+		}
+		feed.Link = origin + "/"
+		feed.SelfLink = origin + r.URL.Path
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Last-Modified", feed.Updated.UTC().Format(http.TimeFormat))
+	if err := publish.Write(w, format, feed); err != nil {
+		slog.Error("couldn't write personal feed", "user", user.Name, "error", err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+)
+
+// inTx runs fn with queries bound to a single transaction, committing when
+// fn succeeds and rolling back otherwise.
+func (s *state) inTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := s.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(s.db.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// relocateFeed points feed at newURL after it was permanently redirected
+// there. When another feed already uses newURL the two are merged: follows,
+// posts, fetch history, webhooks and credentials move to the existing feed
+// and feed is deleted. Feeds whose credentials differ are left apart, since
+// either set may be the one the new URL needs. It returns the feed that now
+// owns newURL, or feed when it wasn't merged, and a note describing the move.
+func relocateFeed(ctx context.Context, s *state, feed database.Feed, newURL string) (database.Feed, string, error) {
+	existing, err := s.db.GetFeedByUrl(ctx, newURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		moved, err := s.db.UpdateFeedUrl(ctx, database.UpdateFeedUrlParams{
+			ID:  feed.ID,
+			Url: newURL,
+		})
+		if err != nil {
+			return feed, "", fmt.Errorf("couldn't update feed URL: %w", err)
+		}
+		return moved, fmt.Sprintf("moved from %s to %s", feed.Url, newURL), nil
+	}
+	if err != nil {
+		return feed, "", fmt.Errorf("couldn't look up feed %s: %w", newURL, err)
+	}
+
+	// feed was fetched, so its credentials can be opened. Those of existing
+	// might not, if they were stored under another key.
+	creds, err := s.openCredentials(feed)
+	if err != nil {
+		return feed, "", err
+	}
+	existingCreds, err := s.openCredentials(existing)
+	if err != nil || (!creds.empty() && !existingCreds.empty() && !creds.equal(existingCreds)) {
+		return feed, fmt.Sprintf("redirected to %s, not merged into %s as their credentials differ", newURL, existing.Name), nil
+	}
+
+	err = s.inTx(ctx, func(q *database.Queries) error {
+		if existingCreds.empty() && !creds.empty() {
+			moved, err := q.SetFeedCredentials(ctx, database.SetFeedCredentialsParams{
+				ID:          existing.ID,
+				Credentials: feed.Credentials,
+			})
+			if err != nil {
+				return fmt.Errorf("couldn't move credentials: %w", err)
+			}
+			existing = moved
+		}
+		if err := q.MoveFeedFollows(ctx, database.MoveFeedFollowsParams{
+			ToFeedID:   existing.ID,
+			FromFeedID: feed.ID,
+		}); err != nil {
+			return fmt.Errorf("couldn't move follows: %w", err)
+		}
+		if err := q.MovePosts(ctx, database.MovePostsParams{
+			ToFeedID:   existing.ID,
+			FromFeedID: feed.ID,
+		}); err != nil {
+			return fmt.Errorf("couldn't move posts: %w", err)
+		}
+		if err := q.MoveFeedFetches(ctx, database.MoveFeedFetchesParams{
+			ToFeedID:   existing.ID,
+			FromFeedID: feed.ID,
+		}); err != nil {
+			return fmt.Errorf("couldn't move fetch history: %w", err)
+		}
+		if err := q.MoveWebhooks(ctx, database.MoveWebhooksParams{
+			ToFeedID:   uuid.NullUUID{UUID: existing.ID, Valid: true},
+			FromFeedID: uuid.NullUUID{UUID: feed.ID, Valid: true},
+		}); err != nil {
+			return fmt.Errorf("couldn't move webhooks: %w", err)
+		}
+		if err := q.DeleteFeed(ctx, feed.ID); err != nil {
+			return fmt.Errorf("couldn't delete feed: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return feed, "", fmt.Errorf("couldn't merge feed into %s: %w", existing.Name, err)
+	}
+	return existing, fmt.Sprintf("moved from %s to %s, merged into %s", feed.Url, newURL, existing.Name), nil
+}
+
+// recordFetch adds a collection of feedID to its fetch history and counts
+// it in the metrics.
+func recordFetch(ctx context.Context, db *database.Queries, feedID uuid.UUID, result scrapeResult, fetchErr error) error {
+	params := database.CreateFeedFetchParams{
+		ID:            uuid.New(),
+		CreatedAt:     time.Now().UTC(),
+		FeedID:        feedID,
+		Status:        "ok",
+		PostsFound:    int32(result.found),
+		PostsInserted: int32(result.inserted),
+		Message:       optionalString(result.moved),
+	}
+	if result.statusCode != 0 {
+		params.HttpStatus = sql.NullInt32{Int32: int32(result.statusCode), Valid: true}
+	}
+	if result.pushed {
+		params.Status = "push"
+	}
+	var robotsErr *RobotsDisallowedError
+	var parseErr *ParseError
+	switch {
+	case errors.As(fetchErr, &robotsErr):
+		params.Status = "skipped"
+		params.Error = optionalString(fetchErr.Error())
+	case fetchErr != nil:
+		params.Status = "error"
+		params.Error = optionalString(fetchErr.Error())
+	}
+
+	code := "none"
+	if result.statusCode != 0 {
+		code = strconv.Itoa(result.statusCode)
+	}
+	fetchesTotal.Inc(params.Status, code)
+	if errors.As(fetchErr, &parseErr) {
+		parseErrorsTotal.Inc()
+	}
+	parseWarningsTotal.Add(float64(result.parseWarnings))
+	return db.CreateFeedFetch(ctx, params)
+}
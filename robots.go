@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// robotsTTL is how long a host's robots.txt is trusted before it is
+	// downloaded again.
+	robotsTTL = 24 * time.Hour
+	// robotsErrorTTL is used instead when robots.txt couldn't be read,
+	// because of a server error or the host being unreachable, so that a
+	// host recovering from an outage is not shut out for a day.
+	robotsErrorTTL = time.Hour
+	// maxRobotsBytes is how much of a robots.txt is read; RFC 9309 asks
+	// for at least 500 KiB.
+	maxRobotsBytes = 512 << 10
+)
+
+// RobotsDisallowedError is returned instead of fetching a feed that the
+// host's robots.txt disallows for our User-Agent.
+type RobotsDisallowedError struct {
+	URL   string
+	Agent string
+}
+
+func (e *RobotsDisallowedError) Error() string {
+	return fmt.Sprintf("robots.txt disallows %s for %s", e.URL, e.Agent)
+}
+
+// robotsChecker decides whether a URL may be fetched according to its
+// host's robots.txt, keeping each host's rules for robotsTTL.
+type robotsChecker struct {
+	f     *fetcher
+	agent string
+
+	mu    sync.Mutex
+	cache map[string]robotsEntry
+}
+
+type robotsEntry struct {
+	rules []robotsRule
+	// err is why robots.txt couldn't be downloaded, returned for every
+	// URL of the host until the entry expires.
+	err     error
+	expires time.Time
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+func newRobotsChecker(f *fetcher) *robotsChecker {
+	return &robotsChecker{
+		f:     f,
+		agent: productToken(f.userAgent),
+		cache: make(map[string]robotsEntry),
+	}
+}
+
+// productToken returns the name robots.txt groups are matched against,
+// such as "gator" for "gator/1.2 (+https://example.com)".
+func productToken(userAgent string) string {
+	token, _, _ := strings.Cut(strings.TrimSpace(userAgent), "/")
+	token, _, _ = strings.Cut(token, " ")
+	return strings.ToLower(token)
+}
+
+// check returns a RobotsDisallowedError when u may not be fetched.
+func (c *robotsChecker) check(ctx context.Context, u *url.URL, rawURL string) error {
+	if u.Path == "/robots.txt" {
+		return nil
+	}
+	origin := u.Scheme + "://" + strings.ToLower(u.Host)
+
+	c.mu.Lock()
+	entry, ok := c.cache[origin]
+	c.mu.Unlock()
+	if !ok || time.Now().After(entry.expires) {
+		rules, ttl, err := c.download(ctx, origin)
+		if ttl == 0 {
+			return err
+		}
+		entry = robotsEntry{rules: rules, err: err, expires: time.Now().Add(ttl)}
+		c.mu.Lock()
+		c.cache[origin] = entry
+		c.mu.Unlock()
+	}
+	if entry.err != nil {
+		return entry.err
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if !robotsAllowed(entry.rules, path) {
+		return &RobotsDisallowedError{URL: rawURL, Agent: c.agent}
+	}
+	return nil
+}
+
+// download fetches and parses the robots.txt of origin, returning how long
+// the outcome holds. Following RFC 9309 a missing file allows everything
+// while a server error disallows everything until it is checked again.
+// When the host can't be reached the error is returned, to be repeated for
+// robotsErrorTTL; errors with a zero TTL, such as a cancelled context, are
+// not to be kept.
+func (c *robotsChecker) download(ctx context.Context, origin string) ([]robotsRule, time.Duration, error) {
+	robotsURL := origin + "/robots.txt"
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("User-Agent", c.f.userAgent)
+
+	release, err := c.f.limiter.acquire(ctx, req.URL.Host, robotsURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+
+	resp, err := c.f.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, err
+		}
+		return nil, robotsErrorTTL, classifyRequestError(robotsURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		rules, err := parseRobots(io.LimitReader(resp.Body, maxRobotsBytes), c.agent)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, err
+			}
+			return nil, robotsErrorTTL, classifyRequestError(robotsURL, err)
+		}
+		return rules, robotsTTL, nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return nil, robotsTTL, nil
+	}
+	return []robotsRule{{allow: false, pattern: "/"}}, robotsErrorTTL, nil
+}
+
+// parseRobots returns the rules of the groups naming agent, or of the "*"
+// groups when none do.
+func parseRobots(r io.Reader, agent string) ([]robotsRule, error) {
+	var specific, wildcard []robotsRule
+	var agents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxRobotsBytes)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", pattern: value}
+			for _, a := range agents {
+				switch a {
+				case agent:
+					specific = append(specific, rule)
+				case "*":
+					wildcard = append(wildcard, rule)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if specific != nil {
+		return specific, nil
+	}
+	return wildcard, nil
+}
+
+// robotsAllowed applies the most specific matching rule to path, with
+// allow winning ties.
+func robotsAllowed(rules []robotsRule, path string) bool {
+	best := -1
+	allowed := true
+	for _, rule := range rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if n := len(rule.pattern); n > best || (n == best && rule.allow) {
+			best = n
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+// robotsMatch matches a robots.txt path pattern, where "*" stands for any
+// run of characters and a trailing "$" anchors the end of the path.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path[pos:], part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+	return !anchored || pos == len(path)
+}
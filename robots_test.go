@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		name string
+		txt  string
+		want []robotsRule
+	}{
+		{
+			"own group over the wildcard",
+			"User-agent: *\nDisallow: /\n\nUser-agent: gator\nDisallow: /private\n",
+			[]robotsRule{{allow: false, pattern: "/private"}},
+		},
+		{
+			"wildcard without an own group",
+			"User-agent: otherbot\nDisallow: /\n\nUser-agent: *\nDisallow: /tmp\nAllow: /tmp/feed.xml\n",
+			[]robotsRule{{allow: false, pattern: "/tmp"}, {allow: true, pattern: "/tmp/feed.xml"}},
+		},
+		{
+			"agent names are case-insensitive",
+			"USER-AGENT: Gator\nDISALLOW: /x\n",
+			[]robotsRule{{allow: false, pattern: "/x"}},
+		},
+		{
+			"group with several agents",
+			"User-agent: otherbot\nUser-agent: gator\nDisallow: /shared\n",
+			[]robotsRule{{allow: false, pattern: "/shared"}},
+		},
+		{
+			"own groups are merged",
+			"User-agent: gator\nDisallow: /a\n\nUser-agent: *\nDisallow: /\n\nUser-agent: gator\nDisallow: /b\n",
+			[]robotsRule{{allow: false, pattern: "/a"}, {allow: false, pattern: "/b"}},
+		},
+		{
+			"a longer product token is another agent",
+			"User-agent: gatorbot\nDisallow: /\n",
+			nil,
+		},
+		{
+			"rules before any user-agent are ignored",
+			"Disallow: /\nUser-agent: gator\nAllow: /\n",
+			[]robotsRule{{allow: true, pattern: "/"}},
+		},
+		{
+			"comments and empty disallows",
+			"# robots.txt\nUser-agent: gator # us\nDisallow:\nDisallow: /private # not this\n",
+			[]robotsRule{{allow: false, pattern: "/private"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRobots(strings.NewReader(tt.txt), "gator")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("rules = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish.asp", false},
+		{"/fish", "/catfish", false},
+		{"/fish*", "/fishheads/yummy.html", true},
+		{"/fish/", "/fish", false},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php", "/windows.PHP", false},
+		{"/*.php$", "/filename.php", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/*.php$", "/filename.php5", false},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"/$", "/", true},
+		{"/$", "/page", false},
+		{"/a*b*c$", "/aXbYc", true},
+		{"/a*b*c$", "/aXbYcZ", false},
+		{"/*/feed", "/blog/feed.xml", true},
+	}
+	for _, tt := range tests {
+		if got := robotsMatch(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRobotsAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []robotsRule
+		path  string
+		want  bool
+	}{
+		{"no rules", nil, "/feed.xml", true},
+		{"no matching rule", []robotsRule{{allow: false, pattern: "/private"}}, "/feed.xml", true},
+		{"longest match wins", []robotsRule{{allow: true, pattern: "/p"}, {allow: false, pattern: "/"}}, "/page", true},
+		{"longest match wins over order", []robotsRule{{allow: false, pattern: "/folder/page"}, {allow: true, pattern: "/folder/"}}, "/folder/page", false},
+		{"allow wins ties", []robotsRule{{allow: false, pattern: "/folder"}, {allow: true, pattern: "/folder"}}, "/folder/page", true},
+		{"wildcard counts towards length", []robotsRule{{allow: true, pattern: "/page"}, {allow: false, pattern: "/*.html"}}, "/page.html", false},
+		{"shorter disallow", []robotsRule{{allow: true, pattern: "/page"}, {allow: false, pattern: "/*.html"}}, "/page.php", true},
+		{"anchored allow", []robotsRule{{allow: true, pattern: "/$"}, {allow: false, pattern: "/"}}, "/", true},
+		{"anchored allow elsewhere", []robotsRule{{allow: true, pattern: "/$"}, {allow: false, pattern: "/"}}, "/page.htm", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := robotsAllowed(tt.rules, tt.path); got != tt.want {
+				t.Errorf("robotsAllowed(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRobotsCheckStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		allowed map[string]bool
+	}{
+		{"rules", http.StatusOK, "User-agent: *\nDisallow: /private\n", map[string]bool{"/feed.xml": true, "/private/feed.xml": false}},
+		{"missing", http.StatusNotFound, "", map[string]bool{"/feed.xml": true, "/private/feed.xml": true}},
+		{"forbidden", http.StatusForbidden, "", map[string]bool{"/feed.xml": true}},
+		{"server error", http.StatusInternalServerError, "", map[string]bool{"/feed.xml": false}},
+		{"unavailable", http.StatusServiceUnavailable, "", map[string]bool{"/feed.xml": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/robots.txt" {
+					t.Errorf("requested %s", r.URL.Path)
+				}
+				hits.Add(1)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := newRobotsChecker(newTestFetcher(t, 0))
+			for path, want := range tt.allowed {
+				u, _ := url.Parse(srv.URL + path)
+				err := c.check(context.Background(), u, u.String())
+				var disallowed *RobotsDisallowedError
+				switch {
+				case want && err != nil:
+					t.Errorf("%s: %v", path, err)
+				case !want && !errors.As(err, &disallowed):
+					t.Errorf("%s: err = %v, want RobotsDisallowedError", path, err)
+				}
+			}
+			if got := hits.Load(); got != 1 {
+				t.Errorf("robots.txt was downloaded %d times, want once", got)
+			}
+		})
+	}
+}
+
+func TestRobotsCheckCachesNetworkErrors(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	c := newRobotsChecker(newTestFetcher(t, 0))
+	u, _ := url.Parse(srv.URL + "/feed.xml")
+	first := c.check(context.Background(), u, u.String())
+	var disallowed *RobotsDisallowedError
+	if first == nil || errors.As(first, &disallowed) {
+		t.Fatalf("err = %v, want a network error", first)
+	}
+	downloads := hits.Load()
+
+	if err := c.check(context.Background(), u, u.String()); err == nil || err.Error() != first.Error() {
+		t.Errorf("second check: err = %v, want %v", err, first)
+	}
+	if got := hits.Load(); got != downloads {
+		t.Errorf("robots.txt was downloaded again within robotsErrorTTL")
+	}
+}
+
+func TestRobotsCheckDoesNotCacheCancellation(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c := newRobotsChecker(newTestFetcher(t, 0))
+	u, _ := url.Parse(srv.URL + "/feed.xml")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.check(ctx, u, u.String()); err == nil {
+		t.Fatal("expected an error with a cancelled context")
+	}
+	if err := c.check(context.Background(), u, u.String()); err != nil {
+		t.Errorf("check after cancellation: %v", err)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("robots.txt was downloaded %d times, want once", got)
+	}
+}
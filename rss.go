@@ -1,12 +1,17 @@
 package main
 
 import (
-	"context"
+	"bytes"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"html"
 	"io"
-	"net/http"
-	"time"
+	"mime"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html/charset"
 )
 
 type RSSFeed struct {
@@ -15,42 +20,88 @@ type RSSFeed struct {
 		Link        string    `xml:"link"`
 		Description string    `xml:"description"`
 		Item        []RSSItem `xml:"item"`
+		// Hub and Self come from <atom:link rel="hub"> and rel="self",
+		// which advertise a WebSub hub and the topic to subscribe to.
+		Hub  string `xml:"-"`
+		Self string `xml:"-"`
 	} `xml:"channel"`
 }
 
+const atomNS = "http://www.w3.org/2005/Atom"
+
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	PubDate     string   `xml:"pubDate"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Author      string   `xml:"author"`
+	Categories  []string `xml:"category"`
+	Comments    string   `xml:"comments"`
+
+	Enclosures     []RSSEnclosure `xml:"enclosure"`
+	ItunesDuration string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	MediaContent   []MediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaGroups    []struct {
+		Content []MediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	} `xml:"http://search.yahoo.com/mrss/ group"`
 }
 
-func fetchFeed(ctx context.Context, feedUrl string) (*RSSFeed, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, "GET", feedUrl, nil)
-	if err != nil {
-		return &RSSFeed{}, err
-	}
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
 
-	req.Header.Set("User-Agent", "gator")
-	resp, err := client.Do(req)
-	if err != nil {
-		return &RSSFeed{}, err
-	}
-	defer resp.Body.Close()
+// MediaContent is a Media RSS <media:content> element.
+type MediaContent struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	FileSize string `xml:"fileSize,attr"`
+	Duration string `xml:"duration,attr"`
+}
 
-	data, err := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return &RSSFeed{}, err
+// AuthorName prefers dc:creator and otherwise turns the RSS author, usually
+// written as "jane@example.com (Jane Doe)", into just the name.
+func (item RSSItem) AuthorName() string {
+	if creator := strings.TrimSpace(item.Creator); creator != "" {
+		return creator
 	}
+	author := strings.TrimSpace(item.Author)
+	if open := strings.Index(author, "("); open > 0 && strings.HasSuffix(author, ")") {
+		return strings.TrimSpace(author[open+1 : len(author)-1])
+	}
+	return author
+}
+
+// parseFeed decodes a feed document into UTF-8 strings. A charset given in
+// the HTTP Content-Type takes precedence over the XML declaration, as
+// required by RFC 7303; otherwise the declared encoding is honored.
+//
+// Parsing is lenient and counts each recovery in the returned number of
+// warnings: stripping control characters counts once, every HTML entity or
+// stray ampersand counts once, and so does every broken item skipped and a
+// document broken off after its items started.
+func parseFeed(data []byte, contentType string) (*RSSFeed, int, error) {
+	warnings := 0
+	data, err := toUTF8(data, contentType)
 	if err != nil {
-		return &RSSFeed{}, err
+		return &RSSFeed{}, warnings, err
 	}
+	// Control characters are only recognizable once the document is UTF-8:
+	// in UTF-16 every ASCII character comes with a zero byte.
+	if stripped, n := stripControlChars(data); n > 0 {
+		data = stripped
+		warnings++
+	}
+	warnings += countLooseReferences(data)
 
 	feed := RSSFeed{}
-	err = xml.Unmarshal(data, &feed)
+	recovered, err := decodeFeed(data, &feed)
+	warnings += recovered
 	if err != nil {
-		return &feed, err
+		return &feed, warnings, err
 	}
 
 	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
@@ -58,7 +109,259 @@ func fetchFeed(ctx context.Context, feedUrl string) (*RSSFeed, error) {
 	for i, item := range feed.Channel.Item {
 		item.Title = html.UnescapeString(item.Title)
 		item.Description = html.UnescapeString(item.Description)
+		item.Creator = html.UnescapeString(item.Creator)
+		item.Author = html.UnescapeString(item.Author)
+		categories := item.Categories[:0]
+		for _, category := range item.Categories {
+			if category = strings.TrimSpace(html.UnescapeString(category)); category != "" {
+				categories = append(categories, category)
+			}
+		}
+		item.Categories = categories
 		feed.Channel.Item[i] = item
 	}
-	return &feed, nil
+	return &feed, warnings, nil
+}
+
+func newFeedDecoder(data []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// The document is UTF-8 now, whatever the XML declaration says.
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	return decoder
+}
+
+// decodeFeed walks the document token by token, decoding each item on its
+// own. The decoder can't go on after a syntax error, so a broken item is
+// skipped by starting a new one at the next <item>, with the start tags of
+// the elements around it replayed in front so that the nesting and
+// namespaces are as before. A syntax error anywhere else keeps what was
+// decoded up to it. Items are accepted anywhere in the document, which also
+// covers RSS 1.0 where they are siblings of the channel.
+func decodeFeed(data []byte, feed *RSSFeed) (int, error) {
+	recovered := 0
+	found := false
+	input := data
+	// shift turns offsets in input into offsets in data.
+	shift := 0
+
+	for {
+		decoder := newFeedDecoder(input)
+		var stack []string
+		var open [][]byte
+		resume := -1
+
+	tokens:
+		for {
+			before := int(decoder.InputOffset())
+			tok, err := decoder.Token()
+			if err == io.EOF {
+				if !found {
+					return recovered, errors.New("document is not an RSS feed")
+				}
+				return recovered, nil
+			}
+			if err != nil {
+				if !found {
+					return recovered, err
+				}
+				return recovered + 1, nil
+			}
+
+			switch t := tok.(type) {
+			case xml.StartElement:
+				parent := ""
+				if len(stack) > 0 {
+					parent = stack[len(stack)-1]
+				}
+
+				switch {
+				case t.Name.Local == "item":
+					found = true
+					item := RSSItem{}
+					if err := decoder.DecodeElement(&item, &t); err != nil {
+						resume = nextItem(data, before+shift+1)
+						break tokens
+					}
+					feed.Channel.Item = append(feed.Channel.Item, item)
+				case parent == "channel":
+					if err := decodeChannelField(decoder, feed, t); err != nil {
+						return recovered + 1, nil
+					}
+				default:
+					if t.Name.Local == "channel" {
+						found = true
+					}
+					stack = append(stack, t.Name.Local)
+					open = append(open, input[before:decoder.InputOffset()])
+				}
+			case xml.EndElement:
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+					open = open[:len(open)-1]
+				}
+			}
+		}
+
+		recovered++
+		if resume < 0 {
+			return recovered, nil
+		}
+		prefix := bytes.Join(open, nil)
+		input = append(prefix, data[resume:]...)
+		shift = resume - len(prefix)
+	}
+}
+
+// nextItem returns the offset of the first <item> start tag in data at or
+// after from, or -1 if there is none.
+func nextItem(data []byte, from int) int {
+	for from < len(data) {
+		i := bytes.Index(data[from:], []byte("<item"))
+		if i < 0 {
+			return -1
+		}
+		at := from + i
+		if end := at + len("<item"); end < len(data) && strings.IndexByte("> \t\r\n/", data[end]) >= 0 {
+			return at
+		}
+		from = at + 1
+	}
+	return -1
+}
+
+// rss10NS is the namespace of RSS 1.0, which puts the channel fields in it
+// rather than in no namespace as RSS 2.0 does.
+const rss10NS = "http://purl.org/rss/1.0/"
+
+func decodeChannelField(decoder *xml.Decoder, feed *RSSFeed, start xml.StartElement) error {
+	if start.Name.Space == atomNS && start.Name.Local == "link" {
+		rel, href := "", ""
+		for _, a := range start.Attr {
+			switch a.Name.Local {
+			case "rel":
+				rel = strings.ToLower(strings.TrimSpace(a.Value))
+			case "href":
+				href = strings.TrimSpace(a.Value)
+			}
+		}
+		switch {
+		case rel == "hub" && feed.Channel.Hub == "":
+			feed.Channel.Hub = href
+		case rel == "self" && feed.Channel.Self == "":
+			feed.Channel.Self = href
+		}
+		return decoder.Skip()
+	}
+	if start.Name.Space != "" && start.Name.Space != rss10NS {
+		return decoder.Skip()
+	}
+	switch start.Name.Local {
+	case "title":
+		return decoder.DecodeElement(&feed.Channel.Title, &start)
+	case "link":
+		return decoder.DecodeElement(&feed.Channel.Link, &start)
+	case "description":
+		return decoder.DecodeElement(&feed.Channel.Description, &start)
+	}
+	return decoder.Skip()
+}
+
+// xmlReference matches a character or entity reference, capturing the
+// entity name.
+var xmlReference = regexp.MustCompile(`^&(?:#[0-9]+|#x[0-9a-fA-F]+|([A-Za-z_][A-Za-z0-9._-]*));`)
+
+// xmlEntities are the entities XML predefines.
+var xmlEntities = map[string]bool{"amp": true, "lt": true, "gt": true, "quot": true, "apos": true}
+
+// countLooseReferences counts the ampersands XML would reject, which the
+// decoder recovers from: references to entities XML doesn't predefine, such
+// as &nbsp;, and ampersands that start no reference at all. Ampersands in
+// CDATA sections and comments are literal and not counted.
+func countLooseReferences(data []byte) int {
+	count := 0
+	for i := 0; i < len(data); i++ {
+		switch {
+		case bytes.HasPrefix(data[i:], []byte("<![CDATA[")):
+			end := bytes.Index(data[i:], []byte("]]>"))
+			if end < 0 {
+				return count
+			}
+			i += end
+		case bytes.HasPrefix(data[i:], []byte("<!--")):
+			end := bytes.Index(data[i:], []byte("-->"))
+			if end < 0 {
+				return count
+			}
+			i += end
+		case data[i] == '&':
+			m := xmlReference.FindSubmatch(data[i:])
+			if m == nil || m[1] != nil && !xmlEntities[string(m[1])] {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// xmlEncoding matches the encoding in an XML declaration.
+var xmlEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*?\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// toUTF8 converts a feed document to UTF-8. Its encoding is taken from the
+// Content-Type charset, a byte order mark, the zero bytes of UTF-16 text
+// or, failing those, the XML declaration. Documents without any are UTF-8.
+func toUTF8(data []byte, contentType string) ([]byte, error) {
+	label := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		if _, name := charset.Lookup(params["charset"]); name != "" {
+			label = params["charset"]
+		}
+	}
+	if label == "" {
+		switch {
+		case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+			label = "utf-8"
+		case bytes.HasPrefix(data, []byte{0xfe, 0xff}), bytes.HasPrefix(data, []byte{0, '<'}):
+			label = "utf-16be"
+		case bytes.HasPrefix(data, []byte{0xff, 0xfe}), bytes.HasPrefix(data, []byte{'<', 0}):
+			label = "utf-16le"
+		default:
+			if m := xmlEncoding.FindSubmatch(data); m != nil {
+				label = string(m[1])
+			}
+		}
+	}
+
+	if label != "" {
+		enc, name := charset.Lookup(label)
+		if enc == nil {
+			return nil, fmt.Errorf("unsupported charset %q", label)
+		}
+		if name != "utf-8" {
+			decoded, err := io.ReadAll(enc.NewDecoder().Reader(bytes.NewReader(data)))
+			if err != nil {
+				return nil, fmt.Errorf("couldn't decode %s: %w", name, err)
+			}
+			data = decoded
+		}
+	}
+	return bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), nil
+}
+
+// stripControlChars removes the C0 control characters that XML forbids,
+// returning the cleaned data and how many were removed.
+func stripControlChars(data []byte) ([]byte, int) {
+	removed := 0
+	clean := make([]byte, 0, len(data))
+	for _, b := range data {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' {
+			removed++
+			continue
+		}
+		clean = append(clean, b)
+	}
+	return clean, removed
 }
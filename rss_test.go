@@ -0,0 +1,183 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes s as UTF-16 in the given byte order, without a BOM.
+func encodeUTF16(s string, bigEndian bool) []byte {
+	var out []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			out = append(out, byte(u>>8), byte(u))
+		} else {
+			out = append(out, byte(u), byte(u>>8))
+		}
+	}
+	return out
+}
+
+func TestParseFeedEncodings(t *testing.T) {
+	const utf16Feed = `<?xml version="1.0" encoding="UTF-16"?><rss><channel><title>Café</title><item><title>Ünïcödé</title></item></channel></rss>`
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+	}{
+		{"utf-8", []byte(`<?xml version="1.0"?><rss><channel><title>Café</title><item><title>Ünïcödé</title></item></channel></rss>`), ""},
+		{"utf-8 with bom", []byte("\xef\xbb\xbf<rss><channel><title>Café</title><item><title>Ünïcödé</title></item></channel></rss>"), ""},
+		{"utf-16le without bom", encodeUTF16(utf16Feed, false), ""},
+		{"utf-16be without bom", encodeUTF16(utf16Feed, true), ""},
+		{"utf-16le with bom", append([]byte{0xff, 0xfe}, encodeUTF16(utf16Feed, false)...), ""},
+		{"utf-16be from content type", encodeUTF16(utf16Feed, true), "application/rss+xml; charset=utf-16be"},
+		{"declared latin-1", []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rss><channel><title>Caf\xe9</title><item><title>\xdcn\xefc\xf6d\xe9</title></item></channel></rss>"), ""},
+		{"content type over declaration", []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?><rss><channel><title>Caf\xe9</title><item><title>\xdcn\xefc\xf6d\xe9</title></item></channel></rss>"), "text/xml; charset=iso-8859-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, warnings, err := parseFeed(tt.data, tt.contentType)
+			if err != nil {
+				t.Fatalf("parseFeed: %v", err)
+			}
+			if warnings != 0 {
+				t.Errorf("got %d warnings, want 0", warnings)
+			}
+			if feed.Channel.Title != "Café" {
+				t.Errorf("title = %q, want %q", feed.Channel.Title, "Café")
+			}
+			if len(feed.Channel.Item) != 1 || feed.Channel.Item[0].Title != "Ünïcödé" {
+				t.Errorf("items = %+v", feed.Channel.Item)
+			}
+		})
+	}
+}
+
+func TestParseFeedStripsControlChars(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte("<rss><channel><title>Bad\x0bfeed\x00</title></channel></rss>"),
+		encodeUTF16("<?xml version=\"1.0\" encoding=\"UTF-16\"?><rss><channel><title>Bad\x0bfeed\x00</title></channel></rss>", false),
+	} {
+		feed, warnings, err := parseFeed(data, "")
+		if err != nil {
+			t.Fatalf("parseFeed: %v", err)
+		}
+		if feed.Channel.Title != "Badfeed" {
+			t.Errorf("title = %q, want %q", feed.Channel.Title, "Badfeed")
+		}
+		if warnings != 1 {
+			t.Errorf("got %d warnings, want 1", warnings)
+		}
+	}
+}
+
+func TestParseFeedUnknownCharset(t *testing.T) {
+	if _, _, err := parseFeed([]byte(`<?xml version="1.0" encoding="x-unknown"?><rss/>`), ""); err == nil {
+		t.Fatal("expected an error for an unknown charset")
+	}
+}
+
+func TestParseFeedRecovers(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		wantWarnings int
+		wantTitles   []string
+	}{
+		{
+			"well-formed references",
+			`<rss><channel><item><title>Tom &amp; Jerry &#233;&#xe9;</title></item><item><title><![CDATA[AT&T]]></title><!-- R&D --></item></channel></rss>`,
+			0,
+			[]string{"Tom & Jerry éé", "AT&T"},
+		},
+		{
+			"html entities",
+			`<rss><channel><item><title>One&nbsp;two&nbsp;three</title></item><item><title>&copy; 2024</title></item></channel></rss>`,
+			3,
+			[]string{"One\u00a0two\u00a0three", "© 2024"},
+		},
+		{
+			"bare ampersand",
+			`<rss><channel><item><title>AT&T & friends</title></item></channel></rss>`,
+			2,
+			[]string{"AT&T & friends"},
+		},
+		{
+			"truncated document",
+			`<rss><channel><item><title>First</title></item><item><title>Second</title></item><item><title>Cut off`,
+			1,
+			[]string{"First", "Second"},
+		},
+		{
+			"broken middle item",
+			`<rss><channel><item><title>First</title></item><item><title>a < b</title></item><item><title>Third</title></item></channel></rss>`,
+			1,
+			[]string{"First", "Third"},
+		},
+		{
+			"two broken items",
+			`<rss xmlns:dc="http://purl.org/dc/elements/1.1/"><channel><item><title>< one</title></item><items/><item><title>< two</title></item><item><title>Third</title><dc:creator>Jane</dc:creator></item></channel></rss>`,
+			2,
+			[]string{"Third"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, warnings, err := parseFeed([]byte(tt.data), "")
+			if err != nil {
+				t.Fatalf("parseFeed: %v", err)
+			}
+			if warnings != tt.wantWarnings {
+				t.Errorf("got %d warnings, want %d", warnings, tt.wantWarnings)
+			}
+			var titles []string
+			for _, item := range feed.Channel.Item {
+				titles = append(titles, item.Title)
+			}
+			if !slices.Equal(titles, tt.wantTitles) {
+				t.Errorf("titles = %q, want %q", titles, tt.wantTitles)
+			}
+		})
+	}
+}
+
+func TestParseFeedRecoveryKeepsNamespaces(t *testing.T) {
+	data := `<rss xmlns:dc="http://purl.org/dc/elements/1.1/"><channel><item><title>< broken</title></item><item><title>Next</title><dc:creator>Jane</dc:creator></item></channel></rss>`
+	feed, _, err := parseFeed([]byte(data), "")
+	if err != nil {
+		t.Fatalf("parseFeed: %v", err)
+	}
+	if len(feed.Channel.Item) != 1 || feed.Channel.Item[0].Creator != "Jane" {
+		t.Errorf("items = %+v", feed.Channel.Item)
+	}
+}
+
+func TestParseFeedRSS10(t *testing.T) {
+	for _, data := range []string{
+		`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+<channel rdf:about="https://example.com/"><title>RDF feed</title><link>https://example.com/</link><description>About it</description>
+<items><rdf:Seq><rdf:li resource="https://example.com/1"/></rdf:Seq></items></channel>
+<item rdf:about="https://example.com/1"><title>First</title><link>https://example.com/1</link></item>
+</rdf:RDF>`,
+		`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:rss="http://purl.org/rss/1.0/">
+<rss:channel><rss:title>RDF feed</rss:title><rss:link>https://example.com/</rss:link><rss:description>About it</rss:description></rss:channel>
+<rss:item><rss:title>First</rss:title><rss:link>https://example.com/1</rss:link></rss:item>
+</rdf:RDF>`,
+	} {
+		feed, warnings, err := parseFeed([]byte(data), "")
+		if err != nil {
+			t.Fatalf("parseFeed: %v", err)
+		}
+		if warnings != 0 {
+			t.Errorf("got %d warnings, want 0", warnings)
+		}
+		ch := feed.Channel
+		if ch.Title != "RDF feed" || ch.Link != "https://example.com/" || ch.Description != "About it" {
+			t.Errorf("channel = %q, %q, %q", ch.Title, ch.Link, ch.Description)
+		}
+		if len(ch.Item) != 1 || ch.Item[0].Title != "First" || ch.Item[0].Link != "https://example.com/1" {
+			t.Errorf("items = %+v", ch.Item)
+		}
+	}
+}
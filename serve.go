@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+func handlerServe(s *state, cmd command) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	addr := fs.String("addr", s.cfg.Serve.ListenAddr(), "address to listen on")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil || len(args) != 0 {
+		return fmt.Errorf("usage: %s [--addr ADDR]", cmd.Name)
+	}
+
+	mux := http.NewServeMux()
+	s.registerWebSub(mux)
+	s.registerAPI(mux)
+	s.registerPublish(mux)
+	mux.Handle("GET /metrics", s.metricsHandler())
+	if err := s.registerWeb(mux); err != nil {
+		return err
+	}
+
+	if s.cfg.Serve.PublicURL != "" {
+		go func() {
+			ctx := context.Background()
+			ticker := time.NewTicker(websubCheckInterval)
+			for ; ; <-ticker.C {
+				s.renewWebSubSubscriptions(ctx)
+			}
+		}()
+	}
+
+	go s.runWebhookWorker(context.Background())
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	slog.Info("listening", "addr", *addr)
+	return server.ListenAndServe()
+}
@@ -0,0 +1,35 @@
+-- name: CreateApiToken :one
+INSERT INTO api_tokens (id, created_at, user_id, name, token_hash)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetApiTokensForUser :many
+SELECT *
+FROM api_tokens
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetUserByApiToken :one
+SELECT users.*
+FROM users
+INNER JOIN api_tokens ON api_tokens.user_id = users.id
+WHERE api_tokens.token_hash = $1
+    AND api_tokens.revoked_at IS NULL;
+
+-- name: MarkApiTokenUsed :exec
+UPDATE api_tokens
+SET last_used_at = NOW()
+WHERE token_hash = $1;
+
+-- name: RevokeApiToken :execrows
+UPDATE api_tokens
+SET revoked_at = NOW()
+WHERE id = $1
+    AND user_id = $2
+    AND revoked_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,25 @@
+-- name: CreateEnclosure :exec
+INSERT INTO enclosures (id, created_at, updated_at, post_id, url, mime_type, length, duration_seconds)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+ON CONFLICT (post_id, url) DO NOTHING;
+
+-- name: GetEnclosuresForPost :many
+SELECT *
+FROM enclosures
+WHERE post_id = $1
+ORDER BY created_at;
+
+-- name: GetEnclosuresForPosts :many
+SELECT *
+FROM enclosures
+WHERE post_id = ANY(sqlc.arg(post_ids)::uuid[])
+ORDER BY created_at;
\ No newline at end of file
@@ -0,0 +1,25 @@
+-- name: CreateFeedFetch :exec
+INSERT INTO feed_fetches (id, created_at, feed_id, status, http_status, posts_found, posts_inserted, error, message)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+);
+
+-- name: GetFeedFetches :many
+SELECT *
+FROM feed_fetches
+WHERE feed_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: MoveFeedFetches :exec
+UPDATE feed_fetches
+SET feed_id = sqlc.arg(to_feed_id)
+WHERE feed_id = sqlc.arg(from_feed_id);
\ No newline at end of file
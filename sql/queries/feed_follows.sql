@@ -21,14 +21,34 @@ INNER JOIN users u ON iff.user_id = u.id;
 
 -- name: GetFeedFollowsForUser :many
 SELECT 
-    ff.*, f.name AS feed_name, u.name AS user_name
+    ff.*, f.name AS feed_name, f.url AS feed_url, u.name AS user_name
 FROM feed_follows ff
 INNER JOIN users u ON ff.user_id = u.id
 INNER JOIN feeds f ON ff.feed_id = f.id 
 WHERE ff.user_id = $1;
 --
 
--- name: DeleteFeedFollow :exec
+-- name: DeleteFeedFollow :execrows
 DELETE FROM feed_follows
 WHERE user_id = $1 AND feed_id = $2;
+--
+
+-- name: MoveFeedFollows :exec
+UPDATE feed_follows
+SET feed_id = sqlc.arg(to_feed_id), updated_at = NOW()
+WHERE feed_id = sqlc.arg(from_feed_id)
+    AND user_id NOT IN (
+        SELECT user_id FROM feed_follows WHERE feed_id = sqlc.arg(to_feed_id)
+    );
+--
+
+-- name: ListFeedFollowsForUser :many
+SELECT
+    ff.*, f.name AS feed_name, f.url AS feed_url, u.name AS user_name
+FROM feed_follows ff
+INNER JOIN users u ON ff.user_id = u.id
+INNER JOIN feeds f ON ff.feed_id = f.id
+WHERE ff.user_id = $1
+ORDER BY ff.created_at, ff.id
+LIMIT $2 OFFSET $3;
 --
\ No newline at end of file
@@ -1,12 +1,13 @@
 -- name: CreateFeed :one
-INSERT INTO feeds (id, name, url, user_id, created_at, updated_at)
+INSERT INTO feeds (id, name, url, user_id, created_at, updated_at, credentials)
 VALUES (
     $1,
     $2,
     $3,
     $4,
     $5,
-    $6
+    $6,
+    $7
 )
 RETURNING *;
 
@@ -18,6 +19,11 @@ SELECT *
 FROM feeds
 WHERE url = $1;
 
+-- name: GetFeedById :one
+SELECT *
+FROM feeds
+WHERE id = $1;
+
 -- name: MarkFeedFetched :one
 UPDATE feeds 
 SET updated_at = NOW(), last_fetched_at = NOW()
@@ -27,5 +33,48 @@ RETURNING *;
 -- name: GetNextFeedToFetch :one
 SELECT *
 FROM feeds
+WHERE NOT EXISTS (
+    SELECT 1 FROM websub_subscriptions
+    WHERE websub_subscriptions.feed_id = feeds.id
+        AND websub_subscriptions.state = 'active'
+        AND websub_subscriptions.lease_expires_at > NOW()
+)
 ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
\ No newline at end of file
+LIMIT 1;
+
+-- name: GetQueueLag :one
+SELECT EXTRACT(EPOCH FROM CASE
+        WHEN last_fetched_at IS NULL THEN (NOW() AT TIME ZONE 'UTC') - created_at
+        ELSE LOCALTIMESTAMP - last_fetched_at
+    END)::float8 AS lag_seconds
+FROM feeds
+WHERE NOT EXISTS (
+    SELECT 1 FROM websub_subscriptions
+    WHERE websub_subscriptions.feed_id = feeds.id
+        AND websub_subscriptions.state = 'active'
+        AND websub_subscriptions.lease_expires_at > NOW()
+)
+ORDER BY last_fetched_at ASC NULLS FIRST
+LIMIT 1;
+
+-- name: UpdateFeedUrl :one
+UPDATE feeds
+SET url = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetFeedCredentials :one
+UPDATE feeds
+SET credentials = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteFeed :exec
+DELETE FROM feeds
+WHERE id = $1;
+
+-- name: ListFeeds :many
+SELECT *
+FROM feeds
+ORDER BY created_at, id
+LIMIT $1 OFFSET $2;
\ No newline at end of file
@@ -0,0 +1,64 @@
+-- name: SetPostRead :exec
+INSERT INTO post_states (id, created_at, updated_at, user_id, post_id, read_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET updated_at = EXCLUDED.updated_at, read_at = EXCLUDED.read_at;
+
+-- name: SetPostStarred :exec
+INSERT INTO post_states (id, created_at, updated_at, user_id, post_id, starred)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET updated_at = EXCLUDED.updated_at, starred = EXCLUDED.starred;
+
+-- name: GetFollowedFeedsWithUnread :many
+SELECT
+    f.id, f.name, f.url, f.last_fetched_at,
+    COUNT(p.id) FILTER (WHERE ps.read_at IS NULL) AS unread_count
+FROM feed_follows ff
+INNER JOIN feeds f ON ff.feed_id = f.id
+LEFT JOIN posts p ON p.feed_id = f.id
+LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = ff.user_id
+WHERE ff.user_id = $1
+GROUP BY f.id
+ORDER BY f.name;
+
+-- name: GetPostsForFeed :many
+SELECT p.*, ps.read_at, COALESCE(ps.starred, FALSE) AS starred
+FROM posts p
+LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = $1
+WHERE p.feed_id = $2
+ORDER BY p.published_at DESC NULLS LAST
+LIMIT $3;
+
+-- name: GetPostWithState :one
+SELECT p.*, f.name AS feed_name, ps.read_at, COALESCE(ps.starred, FALSE) AS starred
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+INNER JOIN feeds f ON p.feed_id = f.id
+LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = ff.user_id
+WHERE ff.user_id = $1 AND p.id = $2;
+
+-- name: ListPostsWithState :many
+SELECT p.*, f.name AS feed_name, ps.read_at, COALESCE(ps.starred, FALSE) AS starred
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+INNER JOIN feeds f ON p.feed_id = f.id
+LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = ff.user_id
+WHERE ff.user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(feed_id)::uuid IS NULL OR p.feed_id = sqlc.narg(feed_id))
+ORDER BY p.published_at DESC NULLS LAST, p.id
+LIMIT sqlc.arg(page_size) OFFSET sqlc.arg(page_offset);
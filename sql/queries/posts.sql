@@ -1,5 +1,5 @@
 -- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, author, categories, comments_url)
 VALUES (
     $1,
     $2,
@@ -8,7 +8,11 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9,
+    $10,
+    $11,
+    $12
 )
 RETURNING *;
 
@@ -19,4 +23,18 @@ INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
 INNER JOIN feeds f ON p.feed_id = f.id
 WHERE ff.user_id = $1
 ORDER BY p.published_at DESC
-LIMIT $2;
\ No newline at end of file
+LIMIT $2;
+
+-- name: MovePosts :exec
+UPDATE posts
+SET feed_id = sqlc.arg(to_feed_id), updated_at = NOW()
+WHERE feed_id = sqlc.arg(from_feed_id);
+
+-- name: ListPostsForUser :many
+SELECT p.*, f.name AS feed_name
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+INNER JOIN feeds f ON p.feed_id = f.id
+WHERE ff.user_id = $1
+ORDER BY p.published_at DESC, p.id
+LIMIT $2 OFFSET $3;
\ No newline at end of file
@@ -1,10 +1,11 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name)
+INSERT INTO users (id, created_at, updated_at, name, hashed_password)
 VALUES (
     $1,
     $2,
     $3,
-    $4
+    $4,
+    $5
 )
 RETURNING *;
 
@@ -20,4 +21,15 @@ DELETE FROM users;
 SELECT * FROM users;
 
 -- name: GetUserById :one
-SELECT * FROM users WHERE id = $1;
\ No newline at end of file
+SELECT * FROM users WHERE id = $1;
+
+-- name: ListUsers :many
+SELECT *
+FROM users
+ORDER BY name
+LIMIT $1 OFFSET $2;
+
+-- name: SetUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
\ No newline at end of file
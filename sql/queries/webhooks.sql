@@ -0,0 +1,80 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, user_id, url, feed_id, keyword, secret)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+RETURNING *;
+
+-- name: GetWebhooksForUser :many
+SELECT w.*, f.url AS feed_url
+FROM webhooks w
+LEFT JOIN feeds f ON w.feed_id = f.id
+WHERE w.user_id = $1
+ORDER BY w.created_at;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = $1 AND user_id = $2;
+
+-- name: MoveWebhooks :exec
+UPDATE webhooks
+SET feed_id = sqlc.arg(to_feed_id)
+WHERE feed_id = sqlc.arg(from_feed_id);
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, created_at, updated_at, webhook_id, post_id, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), NOW(), w.id, p.id, NOW()
+FROM posts p
+INNER JOIN webhooks w ON w.feed_id = p.feed_id
+    OR (w.feed_id IS NULL AND EXISTS (
+        SELECT 1 FROM feed_follows ff
+        WHERE ff.user_id = w.user_id AND ff.feed_id = p.feed_id
+    ))
+WHERE p.id = sqlc.arg(post_id)
+    AND (w.keyword IS NULL
+        OR strpos(lower(sqlc.arg(text)::text), lower(w.keyword)) > 0)
+ON CONFLICT (webhook_id, post_id) DO NOTHING;
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries d
+SET next_attempt_at = NOW() + make_interval(secs => sqlc.arg(lease_seconds)::float8), updated_at = NOW()
+FROM webhooks w, posts p, feeds f
+WHERE d.id IN (
+        SELECT id FROM webhook_deliveries
+        WHERE state = 'pending' AND next_attempt_at <= NOW()
+        ORDER BY next_attempt_at
+        LIMIT sqlc.arg(batch_size)
+        FOR UPDATE SKIP LOCKED
+    )
+    AND w.id = d.webhook_id
+    AND p.id = d.post_id
+    AND f.id = p.feed_id
+RETURNING d.id, d.attempts, w.id AS webhook_id, w.url AS webhook_url, w.secret,
+    p.id AS post_id, p.title, p.url AS post_url, p.description, p.published_at, p.content, p.author, p.categories, p.comments_url,
+    f.id AS feed_id, f.name AS feed_name, f.url AS feed_url;
+
+-- name: UpdateWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET updated_at = NOW(),
+    state = sqlc.arg(state),
+    attempts = attempts + 1,
+    next_attempt_at = NOW() + make_interval(secs => sqlc.arg(retry_in_seconds)::float8),
+    last_status = sqlc.arg(last_status),
+    last_error = sqlc.arg(last_error),
+    delivered_at = CASE WHEN sqlc.arg(state) = 'delivered' THEN NOW() END
+WHERE id = sqlc.arg(id);
+
+-- name: GetWebhookDeliveries :many
+SELECT d.*, p.title AS post_title
+FROM webhook_deliveries d
+INNER JOIN webhooks w ON d.webhook_id = w.id
+INNER JOIN posts p ON d.post_id = p.id
+WHERE d.webhook_id = $1 AND w.user_id = $2
+ORDER BY d.created_at DESC
+LIMIT $3;
\ No newline at end of file
@@ -0,0 +1,40 @@
+-- name: CreateWebSubSubscription :one
+INSERT INTO websub_subscriptions (id, created_at, updated_at, feed_id, hub_url, topic_url, secret, state)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetWebSubSubscription :one
+SELECT *
+FROM websub_subscriptions
+WHERE id = $1;
+
+-- name: GetWebSubSubscriptionForFeed :one
+SELECT *
+FROM websub_subscriptions
+WHERE feed_id = $1;
+
+-- name: ActivateWebSubSubscription :exec
+UPDATE websub_subscriptions
+SET state = 'active', lease_expires_at = NOW() + make_interval(secs => sqlc.arg(lease_seconds)::float8), updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
+-- name: SetWebSubSubscriptionState :exec
+UPDATE websub_subscriptions
+SET state = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetWebSubSubscriptionsToRenew :many
+SELECT *
+FROM websub_subscriptions
+WHERE (state = 'active' AND lease_expires_at < NOW() + make_interval(secs => sqlc.arg(renew_within_seconds)::float8))
+    OR (state = 'pending' AND updated_at < NOW() - make_interval(secs => sqlc.arg(retry_after_seconds)::float8))
+ORDER BY updated_at ASC;
\ No newline at end of file
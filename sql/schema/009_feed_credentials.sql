@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE feeds ADD COLUMN credentials BYTEA;
+
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN credentials;
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE feed_fetches (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    http_status INTEGER,
+    posts_found INTEGER NOT NULL DEFAULT 0,
+    posts_inserted INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    message TEXT
+);
+
+-- +goose Down
+DROP TABLE feed_fetches;
\ No newline at end of file
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+	"github.com/zyaeger/gator/internal/output"
+)
+
+// tokenPrefix makes gator tokens easy to recognise, for example by secret
+// scanners.
+const tokenPrefix = "gtr_"
+
+// handlerToken manages the API tokens of the logged-in user. Only the
+// SHA-256 of a token is stored, so it is shown once, when created.
+func handlerToken(s *state, cmd command, user database.User) error {
+	usage := fmt.Errorf("usage: %s create <name> | list | revoke <id>", cmd.Name)
+	if len(cmd.Args) == 0 {
+		return usage
+	}
+
+	switch sub, args := cmd.Args[0], cmd.Args[1:]; {
+	case sub == "create" && len(args) == 1:
+		return createToken(s, user, args[0])
+	case sub == "list" && len(args) == 0:
+		return listTokens(s, user)
+	case sub == "revoke" && len(args) == 1:
+		return revokeToken(s, user, args[0])
+	}
+	return usage
+}
+
+func createToken(s *state, user database.User, name string) error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	hash := sha256.Sum256([]byte(token))
+
+	created, err := s.db.CreateApiToken(context.Background(), database.CreateApiTokenParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: hash[:],
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't create token: %w", err)
+	}
+
+	fmt.Printf("Token %s (%s) created for %s. It won't be shown again:\n", created.Name, created.ID, user.Name)
+	fmt.Println(token)
+	return nil
+}
+
+func listTokens(s *state, user database.User) error {
+	tokens, err := s.db.GetApiTokensForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get tokens: %w", err)
+	}
+
+	table := output.NewTable("id", "name", "created_at", "last_used_at", "revoked_at")
+	for _, token := range tokens {
+		table.Append(token.ID, token.Name, token.CreatedAt, nullTime(token.LastUsedAt), nullTime(token.RevokedAt))
+	}
+
+	return s.render(table, func() {
+		if len(tokens) == 0 {
+			fmt.Println("No tokens found.")
+			return
+		}
+		for _, token := range tokens {
+			fmt.Printf("* %s %s\n", token.ID, token.Name)
+			fmt.Printf("  Created:   %v\n", token.CreatedAt)
+			if token.LastUsedAt.Valid {
+				fmt.Printf("  Last used: %v\n", token.LastUsedAt.Time)
+			}
+			if token.RevokedAt.Valid {
+				fmt.Printf("  Revoked:   %v\n", token.RevokedAt.Time)
+			}
+		}
+	})
+}
+
+func revokeToken(s *state, user database.User, rawID string) error {
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return fmt.Errorf("invalid token id: %w", err)
+	}
+	revoked, err := s.db.RevokeApiToken(context.Background(), database.RevokeApiTokenParams{
+		ID:     id,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't revoke token: %w", err)
+	}
+	if revoked == 0 {
+		return errors.New("no active token with that id")
+	}
+	fmt.Println("Token revoked.")
+	return nil
+}
+
+// userForToken returns the owner of an unrevoked token, or sql.ErrNoRows.
+func (s *state) userForToken(ctx context.Context, token string) (database.User, error) {
+	hash := sha256.Sum256([]byte(token))
+	user, err := s.db.GetUserByApiToken(ctx, hash[:])
+	if err != nil {
+		return user, err
+	}
+	if err := s.db.MarkApiTokenUsed(ctx, hash[:]); err != nil {
+		return user, err
+	}
+	return user, nil
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+	"github.com/zyaeger/gator/internal/render"
+	"golang.org/x/term"
+)
+
+const tuiPostLimit = 200
+
+type tuiPane int
+
+const (
+	paneFeeds tuiPane = iota
+	panePosts
+	panePreview
+)
+
+// tui is a full-screen reader over the feeds followed by one user.
+type tui struct {
+	s    *state
+	user database.User
+	out  *bufio.Writer
+
+	feeds   []database.GetFollowedFeedsWithUnreadRow
+	posts   []database.GetPostsForFeedRow
+	feedIdx int
+	postIdx int
+	scroll  int
+	focus   tuiPane
+	status  string
+
+	width  int
+	height int
+}
+
+func handlerTUI(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 0 {
+		return errors.New("zero arguments expected")
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("tui needs an interactive terminal")
+	}
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("couldn't switch terminal to raw mode: %w", err)
+	}
+	defer term.Restore(fd, oldState)
+
+	t := &tui{
+		s:    s,
+		user: user,
+		out:  bufio.NewWriter(os.Stdout),
+	}
+	t.out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		t.out.WriteString("\x1b[?25h\x1b[?1049l")
+		t.out.Flush()
+	}()
+
+	if err := t.loadFeeds(); err != nil {
+		return err
+	}
+	return t.run()
+}
+
+// run reads keys until the user quits. The terminal size is polled so the
+// layout follows resizes without relying on platform-specific signals.
+func (t *tui) run() error {
+	keys := make(chan string)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- string(buf[:n])
+		}
+	}()
+
+	resize := time.NewTicker(250 * time.Millisecond)
+	defer resize.Stop()
+
+	t.draw()
+	for {
+		select {
+		case chunk, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, key := range splitKeys(chunk) {
+				if quit := t.handleKey(key); quit {
+					return nil
+				}
+			}
+			t.draw()
+		case <-resize.C:
+			w, h, err := term.GetSize(int(os.Stdout.Fd()))
+			if err == nil && (w != t.width || h != t.height) {
+				t.draw()
+			}
+		}
+	}
+}
+
+// splitKeys breaks a chunk read from the terminal into single key presses,
+// keeping escape sequences such as arrow keys together.
+func splitKeys(chunk string) []string {
+	var keys []string
+	for len(chunk) > 0 {
+		if strings.HasPrefix(chunk, "\x1b[") && len(chunk) >= 3 {
+			end := 2
+			for end < len(chunk) && (chunk[end] < 0x40 || chunk[end] > 0x7e) {
+				end++
+			}
+			if end < len(chunk) {
+				end++
+			}
+			keys = append(keys, chunk[:end])
+			chunk = chunk[end:]
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(chunk)
+		keys = append(keys, chunk[:size])
+		chunk = chunk[size:]
+	}
+	return keys
+}
+
+func (t *tui) handleKey(key string) bool {
+	t.status = ""
+	switch key {
+	case "q", "\x03":
+		return true
+	case "\t", "\x1b[C", "l":
+		if t.focus < panePreview {
+			t.focus++
+		}
+	case "\x1b[Z", "\x1b[D", "h":
+		if t.focus > paneFeeds {
+			t.focus--
+		}
+	case "j", "\x1b[B":
+		t.move(1)
+	case "k", "\x1b[A":
+		t.move(-1)
+	case " ", "\x1b[6~":
+		t.move(t.height / 2)
+	case "b", "\x1b[5~":
+		t.move(-t.height / 2)
+	case "\r", "\n":
+		if t.focus == paneFeeds {
+			t.focus = panePosts
+		} else if t.focus == panePosts && len(t.posts) > 0 {
+			t.focus = panePreview
+			t.setRead(true)
+		}
+	case "m":
+		if post := t.currentPost(); post != nil {
+			t.setRead(!post.ReadAt.Valid)
+		}
+	case "s":
+		t.toggleStar()
+	case "o":
+		if post := t.currentPost(); post != nil {
+			if err := openBrowser(post.Url); err != nil {
+				t.status = fmt.Sprintf("couldn't open browser: %v", err)
+			} else {
+				t.setRead(true)
+			}
+		}
+	case "r":
+		t.refresh()
+	}
+	return false
+}
+
+func (t *tui) move(delta int) {
+	switch t.focus {
+	case paneFeeds:
+		if len(t.feeds) == 0 {
+			return
+		}
+		idx := clamp(t.feedIdx+delta, 0, len(t.feeds)-1)
+		if idx != t.feedIdx {
+			t.feedIdx = idx
+			t.loadPosts()
+		}
+	case panePosts:
+		if len(t.posts) == 0 {
+			return
+		}
+		t.postIdx = clamp(t.postIdx+delta, 0, len(t.posts)-1)
+		t.scroll = 0
+	case panePreview:
+		t.scroll = max(t.scroll+delta, 0)
+	}
+}
+
+func (t *tui) loadFeeds() error {
+	feeds, err := t.s.db.GetFollowedFeedsWithUnread(context.Background(), t.user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get feeds for user: %w", err)
+	}
+	t.feeds = feeds
+	t.feedIdx = clamp(t.feedIdx, 0, max(len(feeds)-1, 0))
+	t.loadPosts()
+	return nil
+}
+
+func (t *tui) loadPosts() {
+	t.posts = nil
+	t.postIdx = 0
+	t.scroll = 0
+	if len(t.feeds) == 0 {
+		return
+	}
+
+	posts, err := t.s.db.GetPostsForFeed(context.Background(), database.GetPostsForFeedParams{
+		UserID: t.user.ID,
+		FeedID: t.feeds[t.feedIdx].ID,
+		Limit:  tuiPostLimit,
+	})
+	if err != nil {
+		t.status = fmt.Sprintf("couldn't get posts: %v", err)
+		return
+	}
+	t.posts = posts
+}
+
+func (t *tui) currentPost() *database.GetPostsForFeedRow {
+	if t.focus == paneFeeds || len(t.posts) == 0 {
+		return nil
+	}
+	return &t.posts[t.postIdx]
+}
+
+func (t *tui) setRead(read bool) {
+	post := t.currentPost()
+	if post == nil || post.ReadAt.Valid == read {
+		return
+	}
+
+	readAt := sql.NullTime{}
+	if read {
+		readAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	}
+	err := t.s.db.SetPostRead(context.Background(), database.SetPostReadParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    t.user.ID,
+		PostID:    post.ID,
+		ReadAt:    readAt,
+	})
+	if err != nil {
+		t.status = fmt.Sprintf("couldn't update post: %v", err)
+		return
+	}
+
+	post.ReadAt = readAt
+	if read {
+		t.feeds[t.feedIdx].UnreadCount--
+	} else {
+		t.feeds[t.feedIdx].UnreadCount++
+	}
+}
+
+func (t *tui) toggleStar() {
+	post := t.currentPost()
+	if post == nil {
+		return
+	}
+
+	err := t.s.db.SetPostStarred(context.Background(), database.SetPostStarredParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    t.user.ID,
+		PostID:    post.ID,
+		Starred:   !post.Starred,
+	})
+	if err != nil {
+		t.status = fmt.Sprintf("couldn't update post: %v", err)
+		return
+	}
+	post.Starred = !post.Starred
+}
+
+// refresh scrapes the selected feed on demand and reloads its posts.
+func (t *tui) refresh() {
+	if len(t.feeds) == 0 {
+		return
+	}
+	selected := t.feeds[t.feedIdx]
+	t.status = fmt.Sprintf("Refreshing %s...", selected.Name)
+	t.draw()
+
+	feed, err := t.s.db.GetFeedByUrl(context.Background(), selected.Url)
+	if err != nil {
+		t.status = fmt.Sprintf("couldn't fetch feed: %v", err)
+		return
+	}
+	result, err := collectFeed(context.Background(), t.s, feed)
+	if err != nil {
+		t.status = fmt.Sprintf("couldn't collect feed %s: %s", feed.Name, describeFetchError(err))
+		return
+	}
+	if err := t.loadFeeds(); err != nil {
+		t.status = err.Error()
+		return
+	}
+	t.status = fmt.Sprintf("Feed %s collected, %d new posts", feed.Name, result.inserted)
+}
+
+func (t *tui) draw() {
+	w, h, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		w, h = 80, 24
+	}
+	t.width, t.height = w, h
+
+	feedWidth := clamp(w/4, 16, 40)
+	rightWidth := max(w-feedWidth-1, 1)
+	bodyHeight := max(h-1, 2)
+	postHeight := max(bodyHeight*2/5, 1)
+	previewHeight := max(bodyHeight-postHeight-1, 0)
+
+	feedLines := t.feedLines(bodyHeight)
+	postLines := t.postLines(postHeight)
+	previewLines := t.previewLines(rightWidth, previewHeight)
+
+	t.out.WriteString("\x1b[H")
+	for y := 0; y < bodyHeight; y++ {
+		t.out.WriteString(t.cell(feedLines, y, feedWidth, paneFeeds))
+		t.out.WriteString("│")
+		switch {
+		case y < postHeight:
+			t.out.WriteString(t.cell(postLines, y, rightWidth, panePosts))
+		case y == postHeight:
+			t.out.WriteString(strings.Repeat("─", rightWidth))
+		default:
+			t.out.WriteString(fit(lineAt(previewLines, y-postHeight-1), rightWidth))
+		}
+		t.out.WriteString("\r\n")
+	}
+
+	status := t.status
+	if status == "" {
+		status = "tab/←→ pane  j/k move  enter open  m read  s star  o browser  r refresh  q quit"
+	}
+	t.out.WriteString("\x1b[7m" + fit(singleLine(status), w) + "\x1b[0m")
+	t.out.Flush()
+}
+
+// cell renders row y of a list pane, highlighting the selected row.
+func (t *tui) cell(lines []string, y, width int, pane tuiPane) string {
+	selected := -1
+	offset := 0
+	switch pane {
+	case paneFeeds:
+		selected, offset = t.feedIdx, listOffset(t.feedIdx, len(lines))
+	case panePosts:
+		selected, offset = t.postIdx, listOffset(t.postIdx, len(lines))
+	}
+
+	text := fit(lineAt(lines, y), width)
+	if y+offset == selected {
+		if t.focus == pane {
+			return "\x1b[7m" + text + "\x1b[0m"
+		}
+		return "\x1b[1m" + text + "\x1b[0m"
+	}
+	return text
+}
+
+func (t *tui) feedLines(height int) []string {
+	if len(t.feeds) == 0 {
+		return []string{"No feeds followed."}
+	}
+	offset := listOffset(t.feedIdx, height)
+	lines := make([]string, 0, height)
+	for _, feed := range t.feeds[offset:min(offset+height, len(t.feeds))] {
+		line := " " + singleLine(feed.Name)
+		if feed.UnreadCount > 0 {
+			line = fmt.Sprintf(" %s (%d)", singleLine(feed.Name), feed.UnreadCount)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (t *tui) postLines(height int) []string {
+	if len(t.posts) == 0 {
+		return []string{"No posts collected for this feed yet, press r to refresh."}
+	}
+	offset := listOffset(t.postIdx, height)
+	lines := make([]string, 0, height)
+	for _, post := range t.posts[offset:min(offset+height, len(t.posts))] {
+		marker := " "
+		if !post.ReadAt.Valid {
+			marker = "●"
+		}
+		star := " "
+		if post.Starred {
+			star = "★"
+		}
+		date := "      "
+		if post.PublishedAt.Valid {
+			date = post.PublishedAt.Time.Format("Jan 02")
+		}
+		lines = append(lines, fmt.Sprintf("%s%s %s  %s", marker, star, date, singleLine(post.Title)))
+	}
+	return lines
+}
+
+func (t *tui) previewLines(width, height int) []string {
+	if len(t.posts) == 0 {
+		return nil
+	}
+	post := t.posts[t.postIdx]
+
+	lines := []string{"\x1b[1m" + singleLine(post.Title) + "\x1b[0m", singleLine(post.Url)}
+	if post.Author.Valid {
+		lines = append(lines, "By "+singleLine(post.Author.String))
+	}
+	if post.PublishedAt.Valid {
+		lines = append(lines, post.PublishedAt.Time.Format("Mon Jan 2 2006 15:04"))
+	}
+	if len(post.Categories) > 0 {
+		lines = append(lines, singleLine(strings.Join(post.Categories, ", ")))
+	}
+	lines = append(lines, "")
+
+	body := post.Description.String
+	if post.Content.Valid {
+		body = post.Content.String
+	}
+	preview := render.HTML(body, render.Options{Width: width, Color: true})
+	for _, line := range strings.Split(preview, "\n") {
+		lines = append(lines, stripControlsKeepingStyle(line))
+	}
+
+	t.scroll = clamp(t.scroll, 0, max(len(lines)-height, 0))
+	return lines[t.scroll:]
+}
+
+// listOffset returns the first visible row of a list so that the selected
+// row stays on screen.
+func listOffset(selected, height int) int {
+	if height <= 0 || selected < height {
+		return 0
+	}
+	return selected - height + 1
+}
+
+func lineAt(lines []string, y int) string {
+	if y < 0 || y >= len(lines) {
+		return ""
+	}
+	return lines[y]
+}
+
+var ansiSequence = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// fit truncates or pads s to exactly width columns, ignoring ANSI styling.
+func fit(s string, width int) string {
+	visible := utf8.RuneCountInString(ansiSequence.ReplaceAllString(s, ""))
+	if visible <= width {
+		return s + strings.Repeat(" ", width-visible)
+	}
+
+	var b strings.Builder
+	count := 0
+	for i := 0; i < len(s) && count < width; {
+		if loc := ansiSequence.FindStringIndex(s[i:]); loc != nil && loc[0] == 0 {
+			b.WriteString(s[i : i+loc[1]])
+			i += loc[1]
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		b.WriteRune(r)
+		i += size
+		count++
+	}
+	return b.String() + "\x1b[0m"
+}
+
+// singleLine collapses the whitespace in s, feed text in particular, and
+// removes the control characters a terminal would act on.
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(stripControls(s)), " ")
+}
+
+// stripControls removes the C0 controls but tab and newline, DEL and the
+// C1 controls, including ESC and CSI, so that text drawn from feeds can't
+// move the cursor, retitle the terminal or change its state.
+func stripControls(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t', r == '\n':
+			return r
+		case r < 0x20, r >= 0x7f && r < 0xa0:
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// stripControlsKeepingStyle is stripControls for rendered text, keeping the
+// SGR sequences it is styled with.
+func stripControlsKeepingStyle(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range ansiSequence.FindAllStringIndex(s, -1) {
+		b.WriteString(stripControls(s[last:loc[0]]))
+		b.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(stripControls(s[last:]))
+	return b.String()
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestSingleLine(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"whitespace", " one\ttwo\n three ", "one two three"},
+		{"escape sequence", "title\x1b]0;owned\x07 here", "title]0;owned here"},
+		{"sgr", "\x1b[31mred\x1b[0m", "[31mred[0m"},
+		{"c1 csi", "a\u009b2Jb", "a2Jb"},
+		{"c0 and del", "a\x00b\x08c\x7fd", "abcd"},
+		{"unicode", "Café ★", "Café ★"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := singleLine(tt.in); got != tt.want {
+				t.Errorf("singleLine(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripControlsKeepingStyle(t *testing.T) {
+	in := "\x1b[1mbold\x1b[0m and \x1b[2Jcleared\x1b]8;;https://evil.example\x07"
+	want := "\x1b[1mbold\x1b[0m and [2Jcleared]8;;https://evil.example"
+	if got := stripControlsKeepingStyle(in); got != want {
+		t.Errorf("stripControlsKeepingStyle(%q) = %q, want %q", in, got, want)
+	}
+}
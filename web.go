@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+	"github.com/zyaeger/gator/internal/sanitize"
+	"github.com/zyaeger/gator/internal/secrets"
+)
+
+const (
+	sessionCookie   = "gator_session"
+	csrfCookie      = "gator_csrf"
+	sessionLifetime = 30 * 24 * time.Hour
+	webPageSize     = 50
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// webUI is the server-rendered reader of "gator serve". Sessions are signed
+// cookies rather than database rows: they name the user and an expiry, and
+// their signature covers the user's password hash, so changing or removing
+// the password ends every session.
+type webUI struct {
+	s      *state
+	key    []byte
+	secure bool
+	pages  map[string]*template.Template
+}
+
+// webPage is the data every template is executed with.
+type webPage struct {
+	Title string
+	User  *database.User
+	CSRF  string
+	Error string
+	Data  any
+}
+
+type webPost struct {
+	database.ListPostsWithStateRow
+	Content template.HTML
+}
+
+func (s *state) registerWeb(mux *http.ServeMux) error {
+	key, err := s.sessionKey()
+	if err != nil {
+		return err
+	}
+	ui := &webUI{
+		s:      s,
+		key:    key,
+		secure: strings.HasPrefix(s.cfg.Serve.PublicURL, "https://"),
+		pages:  map[string]*template.Template{},
+	}
+	funcs := template.FuncMap{
+		"date": func(t sql.NullTime) string {
+			if !t.Valid {
+				return ""
+			}
+			return t.Time.Local().Format("2006-01-02 15:04")
+		},
+	}
+	for _, page := range []string{"login", "feeds", "posts", "post"} {
+		ui.pages[page], err = template.New(page).Funcs(funcs).ParseFS(webFiles, "web/layout.html", "web/"+page+".html")
+		if err != nil {
+			return fmt.Errorf("couldn't parse %s template: %w", page, err)
+		}
+	}
+	static, err := fs.Sub(webFiles, "web/static")
+	if err != nil {
+		return err
+	}
+
+	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServerFS(static)))
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+	})
+	mux.HandleFunc("GET /login", ui.showLogin)
+	mux.HandleFunc("POST /login", ui.login)
+	mux.HandleFunc("POST /logout", ui.logout)
+	mux.HandleFunc("GET /feeds", ui.loggedIn(ui.showFeeds))
+	mux.HandleFunc("POST /feeds/follow", ui.loggedIn(ui.follow))
+	mux.HandleFunc("POST /feeds/{id}/unfollow", ui.loggedIn(ui.unfollow))
+	mux.HandleFunc("GET /posts", ui.loggedIn(ui.showPosts))
+	mux.HandleFunc("GET /posts/{id}", ui.loggedIn(ui.showPost))
+	mux.HandleFunc("POST /posts/{id}/read", ui.loggedIn(ui.markRead))
+	return nil
+}
+
+// sessionKey reads the configured signing key or makes up a random one.
+func (s *state) sessionKey() ([]byte, error) {
+	if s.cfg.Serve.SessionKey != "" {
+		key, err := secrets.ParseKey(s.cfg.Serve.SessionKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session key: %w", err)
+		}
+		return key, nil
+	}
+	slog.Warn("no session key configured, web sessions end when serve stops")
+	key := make([]byte, secrets.KeySize)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+// mac signs parts, which must not contain NUL bytes, with the UI's key.
+func (ui *webUI) mac(parts ...string) string {
+	h := hmac.New(sha256.New, ui.key)
+	h.Write([]byte(strings.Join(parts, "\x00")))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (ui *webUI) setCookie(w http.ResponseWriter, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   ui.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (ui *webUI) startSession(w http.ResponseWriter, user database.User) {
+	expires := strconv.FormatInt(time.Now().Add(sessionLifetime).Unix(), 10)
+	sig := ui.mac("session", user.ID.String(), expires, user.HashedPassword.String)
+	ui.setCookie(w, sessionCookie, user.ID.String()+"."+expires+"."+sig, int(sessionLifetime.Seconds()))
+}
+
+// sessionUser returns the user whose valid session cookie came with r.
+func (ui *webUI) sessionUser(r *http.Request) (database.User, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return database.User{}, false
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 {
+		return database.User{}, false
+	}
+	id, err := uuid.Parse(parts[0])
+	if err != nil {
+		return database.User{}, false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return database.User{}, false
+	}
+	user, err := ui.s.db.GetUserById(r.Context(), id)
+	if err != nil || !user.HashedPassword.Valid {
+		return database.User{}, false
+	}
+	expected := ui.mac("session", parts[0], parts[1], user.HashedPassword.String)
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// csrfToken returns the token forms must carry. It is the signature of a
+// random value kept in a cookie, so another site can neither read nor
+// forge it.
+func (ui *webUI) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return ui.mac("csrf", cookie.Value)
+	}
+	nonce := rand.Text()
+	ui.setCookie(w, csrfCookie, nonce, 0)
+	return ui.mac("csrf", nonce)
+}
+
+func (ui *webUI) validCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return hmac.Equal([]byte(ui.mac("csrf", cookie.Value)), []byte(r.PostFormValue("csrf")))
+}
+
+// loggedIn is middlewareLoggedIn for the web UI. Visitors without a session
+// are sent to the login page, and forms without a valid CSRF token are
+// rejected.
+func (ui *webUI) loggedIn(handler func(http.ResponseWriter, *http.Request, database.User)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ui.sessionUser(r)
+		if !ok {
+			if r.Method != http.MethodGet {
+				http.Error(w, "session expired, please log in again", http.StatusForbidden)
+				return
+			}
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+		if r.Method == http.MethodPost && !ui.validCSRF(r) {
+			http.Error(w, "invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		handler(w, r, user)
+	}
+}
+
+func (ui *webUI) render(w http.ResponseWriter, r *http.Request, status int, name string, page webPage) {
+	page.CSRF = ui.csrfToken(w, r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src *; media-src *; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := ui.pages[name].ExecuteTemplate(w, "layout", page); err != nil {
+		slog.Error("couldn't render page", "page", name, "error", err)
+	}
+}
+
+func (ui *webUI) fail(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	slog.Error("web UI request failed", "error", err)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+// localPath returns next if it is a path on this server, for redirects
+// after a form is submitted, and fallback otherwise. Browsers drop tabs and
+// newlines from URLs, so paths with control characters are refused too.
+func localPath(next, fallback string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") ||
+		strings.ContainsFunc(next, unicode.IsControl) {
+		return fallback
+	}
+	return next
+}
+
+func (ui *webUI) showLogin(w http.ResponseWriter, r *http.Request) {
+	ui.render(w, r, http.StatusOK, "login", webPage{Title: "Log in", Data: r.URL.Query().Get("next")})
+}
+
+func (ui *webUI) login(w http.ResponseWriter, r *http.Request) {
+	next := r.PostFormValue("next")
+	if !ui.validCSRF(r) {
+		http.Error(w, "invalid CSRF token", http.StatusForbidden)
+		return
+	}
+	user, err := ui.s.db.GetUser(r.Context(), r.PostFormValue("name"))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		ui.fail(w, err)
+		return
+	}
+	if err != nil || !passwordMatches(user, r.PostFormValue("password")) {
+		page := webPage{Title: "Log in", Data: next, Error: "Unknown user or wrong password. Users without a password must set one with gator passwd first."}
+		ui.render(w, r, http.StatusUnauthorized, "login", page)
+		return
+	}
+	ui.startSession(w, user)
+	http.Redirect(w, r, localPath(next, "/feeds"), http.StatusSeeOther)
+}
+
+func (ui *webUI) logout(w http.ResponseWriter, r *http.Request) {
+	if !ui.validCSRF(r) {
+		http.Error(w, "invalid CSRF token", http.StatusForbidden)
+		return
+	}
+	ui.setCookie(w, sessionCookie, "", -1)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (ui *webUI) showFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
+	ui.renderFeeds(w, r, user, http.StatusOK, "")
+}
+
+func (ui *webUI) renderFeeds(w http.ResponseWriter, r *http.Request, user database.User, status int, message string) {
+	feeds, err := ui.s.db.GetFollowedFeedsWithUnread(r.Context(), user.ID)
+	if err != nil {
+		ui.fail(w, err)
+		return
+	}
+	ui.render(w, r, status, "feeds", webPage{Title: "Feeds", User: &user, Error: message, Data: feeds})
+}
+
+func (ui *webUI) follow(w http.ResponseWriter, r *http.Request, user database.User) {
+	feed, err := ui.s.db.GetFeedByUrl(r.Context(), strings.TrimSpace(r.PostFormValue("url")))
+	if errors.Is(err, sql.ErrNoRows) {
+		ui.renderFeeds(w, r, user, http.StatusNotFound, "No feed with that URL; add it with gator addfeed first.")
+		return
+	}
+	if err != nil {
+		ui.fail(w, err)
+		return
+	}
+	if _, err := followFeed(r.Context(), ui.s, user, feed); err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			ui.renderFeeds(w, r, user, http.StatusConflict, "You already follow "+feed.Name+".")
+			return
+		}
+		ui.fail(w, err)
+		return
+	}
+	http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+}
+
+func (ui *webUI) unfollow(w http.ResponseWriter, r *http.Request, user database.User) {
+	feedID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	_, err = ui.s.db.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{
+		UserID: user.ID,
+		FeedID: feedID,
+	})
+	if err != nil {
+		ui.fail(w, err)
+		return
+	}
+	http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+}
+
+func (ui *webUI) showPosts(w http.ResponseWriter, r *http.Request, user database.User) {
+	query := r.URL.Query()
+	params := database.ListPostsWithStateParams{
+		UserID:   user.ID,
+		PageSize: webPageSize + 1,
+	}
+	if raw := query.Get("feed"); raw != "" {
+		feedID, err := uuid.Parse(raw)
+		if err != nil {
+			http.Error(w, "invalid feed id", http.StatusBadRequest)
+			return
+		}
+		params.FeedID = uuid.NullUUID{UUID: feedID, Valid: true}
+	}
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	params.PageOffset = int32((page - 1) * webPageSize)
+
+	posts, err := ui.s.db.ListPostsWithState(r.Context(), params)
+	if err != nil {
+		ui.fail(w, err)
+		return
+	}
+	data := struct {
+		Posts   []database.ListPostsWithStateRow
+		Page    int
+		PrevURL string
+		NextURL string
+		Current string
+	}{Posts: posts, Page: page, Current: r.URL.RequestURI()}
+	if len(posts) > webPageSize {
+		data.Posts = posts[:webPageSize]
+		query.Set("page", strconv.Itoa(page+1))
+		data.NextURL = "/posts?" + query.Encode()
+	}
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page-1))
+		data.PrevURL = "/posts?" + query.Encode()
+	}
+	title := "All posts"
+	if params.FeedID.Valid && len(posts) > 0 {
+		title = posts[0].FeedName
+	}
+	ui.render(w, r, http.StatusOK, "posts", webPage{Title: title, User: &user, Data: data})
+}
+
+// showPost shows one post, marking it read like opening it in the tui does.
+func (ui *webUI) showPost(w http.ResponseWriter, r *http.Request, user database.User) {
+	postID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	post, err := ui.s.db.GetPostWithState(r.Context(), database.GetPostWithStateParams{
+		UserID: user.ID,
+		ID:     postID,
+	})
+	if err != nil {
+		ui.fail(w, err)
+		return
+	}
+	if !post.ReadAt.Valid {
+		if err := setPostRead(r.Context(), ui.s, user, post.ID, true); err != nil {
+			ui.fail(w, err)
+			return
+		}
+	}
+
+	content := post.Content.String
+	if content == "" {
+		content = post.Description.String
+	}
+	// Content is cleaned when it is stored; cleaning it again protects
+	// against rows written by older versions.
+	view := webPost{
+		ListPostsWithStateRow: database.ListPostsWithStateRow(post),
+		Content:               template.HTML(sanitize.HTML(content, post.Url)),
+	}
+	ui.render(w, r, http.StatusOK, "post", webPage{Title: post.Title, User: &user, Data: view})
+}
+
+// markRead sets the read state of a post from one of the feeds the user
+// follows; other posts are not found.
+func (ui *webUI) markRead(w http.ResponseWriter, r *http.Request, user database.User) {
+	postID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	post, err := ui.s.db.GetPostWithState(r.Context(), database.GetPostWithStateParams{
+		UserID: user.ID,
+		ID:     postID,
+	})
+	if err != nil {
+		ui.fail(w, err)
+		return
+	}
+	if err := setPostRead(r.Context(), ui.s, user, post.ID, r.PostFormValue("read") == "true"); err != nil {
+		ui.fail(w, err)
+		return
+	}
+	http.Redirect(w, r, localPath(r.PostFormValue("next"), "/posts"), http.StatusSeeOther)
+}
+
+func setPostRead(ctx context.Context, s *state, user database.User, postID uuid.UUID, read bool) error {
+	now := time.Now().UTC()
+	readAt := sql.NullTime{}
+	if read {
+		readAt = sql.NullTime{Time: now, Valid: true}
+	}
+	return s.db.SetPostRead(ctx, database.SetPostReadParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    user.ID,
+		PostID:    postID,
+		ReadAt:    readAt,
+	})
+}
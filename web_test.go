@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+)
+
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		next string
+		want string
+	}{
+		{"/posts", "/posts"},
+		{"/posts?feed=1&page=2", "/posts?feed=1&page=2"},
+		{"", "/fallback"},
+		{"posts", "/fallback"},
+		{"https://evil.example/", "/fallback"},
+		{"//evil.example/", "/fallback"},
+		{"/\\evil.example/", "/fallback"},
+		{"/\t/evil.example/", "/fallback"},
+		{"/\n/evil.example/", "/fallback"},
+	}
+	for _, tt := range tests {
+		if got := localPath(tt.next, "/fallback"); got != tt.want {
+			t.Errorf("localPath(%q) = %q, want %q", tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestValidCSRF(t *testing.T) {
+	ui := &webUI{key: []byte("0123456789abcdef0123456789abcdef")}
+	other := &webUI{key: []byte("fedcba9876543210fedcba9876543210")}
+
+	tests := []struct {
+		name   string
+		cookie string
+		token  string
+		want   bool
+	}{
+		{"matching token", "nonce", ui.mac("csrf", "nonce"), true},
+		{"no cookie", "", ui.mac("csrf", "nonce"), false},
+		{"no token", "nonce", "", false},
+		{"token for another cookie", "other", ui.mac("csrf", "nonce"), false},
+		{"token signed with another key", "nonce", other.mac("csrf", "nonce"), false},
+		{"cookie used as token", "nonce", "nonce", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"csrf": {tt.token}}
+			r := httptest.NewRequest("POST", "/feeds/follow", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: csrfCookie, Value: tt.cookie})
+			}
+			if got := ui.validCSRF(r); got != tt.want {
+				t.Errorf("validCSRF = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// sessionRequest returns a GET request carrying value as its session cookie.
+func sessionRequest(value string) *http.Request {
+	r := httptest.NewRequest("GET", "/feeds", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+	return r
+}
+
+// sessionCookieFor signs a session cookie for user like startSession does.
+func sessionCookieFor(ui *webUI, user database.User, expires time.Time) string {
+	unix := strconv.FormatInt(expires.Unix(), 10)
+	return user.ID.String() + "." + unix + "." + ui.mac("session", user.ID.String(), unix, user.HashedPassword.String)
+}
+
+// Malformed and expired sessions are turned away before the user is looked
+// up, which the missing database would otherwise fail.
+func TestSessionUserRejectsWithoutLookup(t *testing.T) {
+	ui := &webUI{s: &state{}, key: []byte("0123456789abcdef0123456789abcdef")}
+	user := database.User{ID: uuid.New()}
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"too few parts", user.ID.String() + ".123"},
+		{"too many parts", user.ID.String() + ".123.sig.extra"},
+		{"bad user id", "alice.123.sig"},
+		{"bad expiry", user.ID.String() + ".soon.sig"},
+		{"expired", sessionCookieFor(ui, user, time.Now().Add(-time.Minute))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ui.sessionUser(sessionRequest(tt.value)); ok {
+				t.Error("session accepted")
+			}
+		})
+	}
+	if _, ok := ui.sessionUser(httptest.NewRequest("GET", "/feeds", nil)); ok {
+		t.Error("request without a cookie accepted")
+	}
+}
+
+const testSessionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+// newWebTestUI returns the web UI of s, serving it from a test server, and
+// a webUI with the same key for signing cookies.
+func newWebTestUI(t *testing.T, s *state) (*httptest.Server, *webUI) {
+	t.Helper()
+	s.cfg.Serve.SessionKey = testSessionKey
+	key, err := base64.StdEncoding.DecodeString(testSessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	if err := s.registerWeb(mux); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &webUI{s: s, key: key}
+}
+
+// setTestPassword gives user a password, as "gator passwd" does.
+func setTestPassword(t *testing.T, s *state, user database.User, password string) database.User {
+	t.Helper()
+	hash, err := hashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.db.SetUserPassword(context.Background(), database.SetUserPasswordParams{
+		ID:             user.ID,
+		HashedPassword: hash,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.HashedPassword = hash
+	return user
+}
+
+func TestSessionUser(t *testing.T) {
+	s := newTestState(t)
+	_, ui := newWebTestUI(t, s)
+	alice := setTestPassword(t, s, createTestUser(t, s, "alice"), "hunter2")
+	bob := createTestUser(t, s, "bob")
+	other := &webUI{s: s, key: []byte("fedcba9876543210fedcba9876543210")}
+
+	rec := httptest.NewRecorder()
+	ui.startSession(rec, alice)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie {
+		t.Fatalf("startSession set %v", cookies)
+	}
+	valid := cookies[0].Value
+	expires := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"started session", valid, true},
+		{"signed by hand", sessionCookieFor(ui, alice, expires), true},
+		{"tampered signature", valid[:len(valid)-2] + "xx", false},
+		{"expiry moved", strings.Replace(sessionCookieFor(ui, alice, expires), strconv.FormatInt(expires.Unix(), 10), strconv.FormatInt(expires.Add(time.Hour).Unix(), 10), 1), false},
+		{"signed with another key", sessionCookieFor(other, alice, expires), false},
+		{"expired", sessionCookieFor(ui, alice, time.Now().Add(-time.Minute)), false},
+		{"user without a password", sessionCookieFor(ui, bob, expires), false},
+		{"unknown user", sessionCookieFor(ui, database.User{ID: uuid.New(), HashedPassword: alice.HashedPassword}, expires), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, ok := ui.sessionUser(sessionRequest(tt.value))
+			if ok != tt.want {
+				t.Fatalf("sessionUser ok = %v, want %v", ok, tt.want)
+			}
+			if ok && user.ID != alice.ID {
+				t.Errorf("sessionUser = %s, want %s", user.Name, alice.Name)
+			}
+		})
+	}
+
+	t.Run("password changed", func(t *testing.T) {
+		setTestPassword(t, s, alice, "correct horse")
+		if _, ok := ui.sessionUser(sessionRequest(valid)); ok {
+			t.Error("session outlived the password")
+		}
+	})
+}
+
+// webPostForm sends a form to server as user, with a valid CSRF token unless
+// the form already has one, and returns the response without following
+// redirects.
+func webPostForm(t *testing.T, server *httptest.Server, ui *webUI, user database.User, path string, form url.Values) *http.Response {
+	t.Helper()
+	if form == nil {
+		form = url.Values{}
+	}
+	if !form.Has("csrf") {
+		form.Set("csrf", ui.mac("csrf", "nonce"))
+	}
+	req, err := http.NewRequest("POST", server.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sessionCookieFor(ui, user, time.Now().Add(time.Hour))})
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: "nonce"})
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+// firstTestPost returns the newest post user sees in feed.
+func firstTestPost(t *testing.T, s *state, user database.User, feed database.Feed) database.ListPostsWithStateRow {
+	t.Helper()
+	posts, err := s.db.ListPostsWithState(context.Background(), database.ListPostsWithStateParams{
+		UserID:   user.ID,
+		FeedID:   uuid.NullUUID{UUID: feed.ID, Valid: true},
+		PageSize: 1,
+	})
+	if err != nil || len(posts) != 1 {
+		t.Fatalf("ListPostsWithState: %v, %d posts", err, len(posts))
+	}
+	return posts[0]
+}
+
+func TestWebMarkReadScoping(t *testing.T) {
+	s := newTestState(t)
+	ctx := context.Background()
+	server, ui := newWebTestUI(t, s)
+	alice := setTestPassword(t, s, createTestUser(t, s, "alice"), "hunter2")
+	bob := createTestUser(t, s, "bob")
+	followed := createTestFeed(t, s, alice, "https://example.com/feed.xml")
+	other := createTestFeed(t, s, bob, "https://example.org/feed.xml")
+	storeItems(ctx, s.db, followed.ID, []RSSItem{{Title: "Followed", Link: "https://example.com/1"}}, &scrapeResult{})
+	storeItems(ctx, s.db, other.ID, []RSSItem{{Title: "Not followed", Link: "https://example.org/1"}}, &scrapeResult{})
+	alicePost := firstTestPost(t, s, alice, followed)
+	bobPost := firstTestPost(t, s, bob, other)
+
+	tests := []struct {
+		name     string
+		post     uuid.UUID
+		form     url.Values
+		status   int
+		location string
+	}{
+		{"post of a followed feed", alicePost.ID, url.Values{"read": {"true"}, "next": {"/posts?page=2"}}, http.StatusSeeOther, "/posts?page=2"},
+		{"redirect off the site", alicePost.ID, url.Values{"read": {"true"}, "next": {"//evil.example/"}}, http.StatusSeeOther, "/posts"},
+		{"post of another user's feed", bobPost.ID, url.Values{"read": {"true"}}, http.StatusNotFound, ""},
+		{"unknown post", uuid.New(), url.Values{"read": {"true"}}, http.StatusNotFound, ""},
+		{"without a CSRF token", alicePost.ID, url.Values{"read": {"true"}, "csrf": {""}}, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := webPostForm(t, server, ui, alice, "/posts/"+tt.post.String()+"/read", tt.form)
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if got := resp.Header.Get("Location"); got != tt.location {
+				t.Errorf("Location = %q, want %q", got, tt.location)
+			}
+		})
+	}
+
+	if post := firstTestPost(t, s, alice, followed); !post.ReadAt.Valid {
+		t.Error("followed post not marked read")
+	}
+	var states int
+	if err := s.sqlDB.QueryRow("SELECT count(*) FROM post_states WHERE post_id = $1", bobPost.ID).Scan(&states); err != nil {
+		t.Fatal(err)
+	}
+	if states != 0 {
+		t.Errorf("post of an unfollowed feed has %d read states", states)
+	}
+}
+
+func TestWebUnfollowScoping(t *testing.T) {
+	s := newTestState(t)
+	ctx := context.Background()
+	server, ui := newWebTestUI(t, s)
+	alice := setTestPassword(t, s, createTestUser(t, s, "alice"), "hunter2")
+	bob := createTestUser(t, s, "bob")
+	followed := createTestFeed(t, s, alice, "https://example.com/feed.xml")
+	other := createTestFeed(t, s, bob, "https://example.org/feed.xml")
+
+	follows := func(user database.User) int {
+		t.Helper()
+		rows, err := s.db.GetFeedFollowsForUser(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(rows)
+	}
+
+	if resp := webPostForm(t, server, ui, alice, "/feeds/"+other.ID.String()+"/unfollow", nil); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("unfollowing another user's feed: status %d", resp.StatusCode)
+	}
+	if n := follows(bob); n != 1 {
+		t.Errorf("bob follows %d feeds after alice unfollowed his, want 1", n)
+	}
+	if n := follows(alice); n != 1 {
+		t.Errorf("alice follows %d feeds, want 1", n)
+	}
+
+	if resp := webPostForm(t, server, ui, alice, "/feeds/"+followed.ID.String()+"/unfollow", url.Values{"csrf": {""}}); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unfollowing without a CSRF token: status %d", resp.StatusCode)
+	}
+	if n := follows(alice); n != 1 {
+		t.Errorf("alice follows %d feeds after a forged unfollow, want 1", n)
+	}
+
+	if resp := webPostForm(t, server, ui, alice, "/feeds/"+followed.ID.String()+"/unfollow", nil); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("unfollowing: status %d", resp.StatusCode)
+	}
+	if n := follows(alice); n != 0 {
+		t.Errorf("alice follows %d feeds after unfollowing, want 0", n)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+	"github.com/zyaeger/gator/internal/output"
+)
+
+const (
+	webhookPollInterval = 10 * time.Second
+	webhookBatchSize    = 10
+	// webhookLease keeps a claimed delivery from being picked up by
+	// another agg or serve while it is being sent.
+	webhookLease       = 5 * time.Minute
+	webhookMaxAttempts = 8
+	webhookMinBackoff  = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+	webhookLogLimit    = 20
+)
+
+// webhookPayload is the body POSTed for each new post.
+type webhookPayload struct {
+	Event      string    `json:"event"`
+	DeliveryID uuid.UUID `json:"delivery_id"`
+	WebhookID  uuid.UUID `json:"webhook_id"`
+	FeedURL    string    `json:"feed_url"`
+	Post       apiPost   `json:"post"`
+}
+
+// handlerWebhook manages the webhooks of the logged-in user. Each one gets
+// the new posts of a feed, or of every followed feed, optionally only
+// those mentioning a keyword.
+func handlerWebhook(s *state, cmd command, user database.User) error {
+	usage := fmt.Errorf("usage: %s add <url> [--feed url] [--keyword x] | list | remove <id> | log <id> [limit]", cmd.Name)
+	if len(cmd.Args) == 0 {
+		return usage
+	}
+
+	switch sub, args := cmd.Args[0], cmd.Args[1:]; {
+	case sub == "add":
+		return addWebhook(s, user, args, usage)
+	case sub == "list" && len(args) == 0:
+		return listWebhooks(s, user)
+	case sub == "remove" && len(args) == 1:
+		return removeWebhook(s, user, args[0])
+	case sub == "log" && (len(args) == 1 || len(args) == 2):
+		return webhookLog(s, user, args)
+	}
+	return usage
+}
+
+func addWebhook(s *state, user database.User, args []string, usage error) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	feedURL := fs.String("feed", "", "only send posts of this feed")
+	keyword := fs.String("keyword", "", "only send posts whose title or description contains this")
+	args, err := parseArgs(fs, args)
+	if err != nil || len(args) != 1 {
+		return usage
+	}
+	target, err := url.Parse(args[0])
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q", args[0])
+	}
+
+	ctx := context.Background()
+	params := database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		Url:       target.String(),
+		Keyword:   optionalString(*keyword),
+	}
+	if *feedURL != "" {
+		feed, err := s.db.GetFeedByUrl(ctx, *feedURL)
+		if err != nil {
+			return fmt.Errorf("couldn't find feed %s: %w", *feedURL, err)
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	params.Secret = hex.EncodeToString(secret)
+
+	webhook, err := s.db.CreateWebhook(ctx, params)
+	if err != nil {
+		return fmt.Errorf("couldn't create webhook: %w", err)
+	}
+	fmt.Printf("Webhook %s created. Its signing secret won't be shown again:\n", webhook.ID)
+	fmt.Println(webhook.Secret)
+	return nil
+}
+
+func listWebhooks(s *state, user database.User) error {
+	webhooks, err := s.db.GetWebhooksForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get webhooks: %w", err)
+	}
+
+	table := output.NewTable("id", "url", "feed_url", "keyword", "created_at")
+	for _, w := range webhooks {
+		table.Append(w.ID, w.Url, nullString(w.FeedUrl), nullString(w.Keyword), w.CreatedAt)
+	}
+
+	return s.render(table, func() {
+		if len(webhooks) == 0 {
+			fmt.Println("No webhooks found.")
+			return
+		}
+		for _, w := range webhooks {
+			fmt.Printf("* %s %s\n", w.ID, w.Url)
+			if w.FeedUrl.Valid {
+				fmt.Printf("  Feed:    %s\n", w.FeedUrl.String)
+			} else {
+				fmt.Println("  Feed:    every followed feed")
+			}
+			if w.Keyword.Valid {
+				fmt.Printf("  Keyword: %s\n", w.Keyword.String)
+			}
+		}
+	})
+}
+
+func removeWebhook(s *state, user database.User, rawID string) error {
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return fmt.Errorf("invalid webhook id: %w", err)
+	}
+	removed, err := s.db.DeleteWebhook(context.Background(), database.DeleteWebhookParams{
+		ID:     id,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't remove webhook: %w", err)
+	}
+	if removed == 0 {
+		return errors.New("no webhook with that id")
+	}
+	fmt.Println("Webhook removed.")
+	return nil
+}
+
+// webhookLog shows the most recent deliveries of a webhook.
+func webhookLog(s *state, user database.User, args []string) error {
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid webhook id: %w", err)
+	}
+	limit := webhookLogLimit
+	if len(args) == 2 {
+		if limit, err = strconv.Atoi(args[1]); err != nil || limit <= 0 {
+			return fmt.Errorf("invalid limit %q", args[1])
+		}
+	}
+
+	deliveries, err := s.db.GetWebhookDeliveries(context.Background(), database.GetWebhookDeliveriesParams{
+		WebhookID: id,
+		UserID:    user.ID,
+		Limit:     int32(limit),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't get deliveries: %w", err)
+	}
+
+	table := output.NewTable("id", "created_at", "post_title", "state", "attempts", "last_status", "last_error", "next_attempt_at", "delivered_at")
+	for _, d := range deliveries {
+		var lastStatus any
+		if d.LastStatus.Valid {
+			lastStatus = d.LastStatus.Int32
+		}
+		table.Append(d.ID, d.CreatedAt, d.PostTitle, d.State, d.Attempts, lastStatus, nullString(d.LastError), d.NextAttemptAt, nullTime(d.DeliveredAt))
+	}
+
+	return s.render(table, func() {
+		if len(deliveries) == 0 {
+			fmt.Println("No deliveries yet.")
+			return
+		}
+		for _, d := range deliveries {
+			fmt.Printf("* %v %s: %s\n", d.CreatedAt.Format(time.DateTime), d.State, d.PostTitle)
+			fmt.Printf("  Attempts: %d\n", d.Attempts)
+			if d.LastStatus.Valid {
+				fmt.Printf("  Status:   %d\n", d.LastStatus.Int32)
+			}
+			if d.LastError.Valid {
+				fmt.Printf("  Error:    %s\n", d.LastError.String)
+			}
+			if d.State == "pending" && d.Attempts > 0 {
+				fmt.Printf("  Retry at: %v\n", d.NextAttemptAt.Format(time.DateTime))
+			}
+		}
+	})
+}
+
+// runWebhookWorker sends queued deliveries until the process exits. Any
+// number of agg and serve processes may run one; deliveries are claimed
+// with FOR UPDATE SKIP LOCKED so each is sent by a single worker.
+func (s *state) runWebhookWorker(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	for ; ; <-ticker.C {
+		s.deliverWebhooks(ctx)
+	}
+}
+
+func (s *state) deliverWebhooks(ctx context.Context) {
+	for {
+		deliveries, err := s.db.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+			LeaseSeconds: webhookLease.Seconds(),
+			BatchSize:    webhookBatchSize,
+		})
+		if err != nil {
+			slog.Error("couldn't claim webhook deliveries", "error", err)
+			return
+		}
+		for _, d := range deliveries {
+			s.attemptDelivery(ctx, d)
+		}
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// attemptDelivery sends d once and records the outcome. Failed deliveries
+// are retried with exponential backoff, or later if the receiver asks for
+// it with Retry-After, until webhookMaxAttempts is reached. Retry times are
+// computed by the database from its own clock, which the claim query
+// compares them with.
+func (s *state) attemptDelivery(ctx context.Context, d database.ClaimWebhookDeliveriesRow) {
+	logger := slog.With("webhook_id", d.WebhookID, "delivery_id", d.ID, "post_id", d.PostID)
+	status, err := s.sendWebhook(ctx, d)
+
+	params := database.UpdateWebhookDeliveryParams{
+		ID:    d.ID,
+		State: "delivered",
+	}
+	if status != 0 {
+		params.LastStatus = sql.NullInt32{Int32: int32(status), Valid: true}
+	}
+	attempts := int(d.Attempts) + 1
+	switch {
+	case err == nil:
+		webhookDeliveriesTotal.Inc("delivered")
+	case attempts >= webhookMaxAttempts:
+		params.State = "failed"
+		params.LastError = optionalString(err.Error())
+		webhookDeliveriesTotal.Inc("failed")
+		logger.Error("webhook delivery failed, giving up", "attempts", attempts, "error", err)
+	default:
+		params.State = "pending"
+		params.LastError = optionalString(err.Error())
+		retryIn := webhookBackoff(attempts, err)
+		params.RetryInSeconds = retryIn.Seconds()
+		webhookDeliveriesTotal.Inc("retry")
+		logger.Warn("webhook delivery failed, will retry", "attempts", attempts, "retry_in", retryIn, "error", err)
+	}
+
+	if err := s.db.UpdateWebhookDelivery(ctx, params); err != nil {
+		logger.Error("couldn't record webhook delivery", "error", err)
+	}
+}
+
+// webhookBackoff doubles the delay after every failed attempt.
+func webhookBackoff(attempts int, err error) time.Duration {
+	delay := webhookMaxBackoff
+	if attempts < 20 {
+		delay = min(webhookMinBackoff<<(attempts-1), webhookMaxBackoff)
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		delay = min(statusErr.RetryAfter, webhookMaxBackoff)
+	}
+	return delay
+}
+
+// sendWebhook sends the payload of d. It returns the response status, if
+// any.
+func (s *state) sendWebhook(ctx context.Context, d database.ClaimWebhookDeliveriesRow) (int, error) {
+	enclosures, err := postEnclosures(ctx, s, []uuid.UUID{d.PostID})
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get enclosures: %w", err)
+	}
+	body, err := json.Marshal(webhookPayload{
+		Event:      "post.created",
+		DeliveryID: d.ID,
+		WebhookID:  d.WebhookID,
+		FeedURL:    d.FeedUrl,
+		Post: apiPost{
+			ID:          d.PostID,
+			Title:       d.Title,
+			URL:         d.PostUrl,
+			FeedID:      d.FeedID,
+			FeedName:    d.FeedName,
+			PublishedAt: optionalTime(d.PublishedAt),
+			Author:      d.Author.String,
+			Categories:  d.Categories,
+			CommentsURL: d.CommentsUrl.String,
+			Description: d.Description.String,
+			Content:     d.Content.String,
+			Enclosures:  toAPIEnclosures(enclosures[d.PostID]),
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return s.postWebhook(ctx, d.WebhookUrl, d.Secret, d.ID, body)
+}
+
+// postWebhook POSTs body to target, signed with secret in
+// X-Gator-Signature-256 like GitHub and WebSub hubs do. Redirects aren't
+// followed: they fail the delivery like any other response outside 2xx.
+func (s *state) postWebhook(ctx context.Context, target, secret string, deliveryID uuid.UUID, body []byte) (int, error) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", s.fetcher.userAgent)
+	req.Header.Set("X-Gator-Event", "post.created")
+	req.Header.Set("X-Gator-Delivery", deliveryID.String())
+	req.Header.Set("X-Gator-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := s.fetcher.webhooks.Do(req)
+	if err != nil {
+		return 0, classifyRequestError(target, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, &HTTPStatusError{
+			URL:        target,
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	retryAfter := func(d time.Duration) error {
+		return &HTTPStatusError{URL: "https://example.com/hook", StatusCode: 503, RetryAfter: d}
+	}
+	tests := []struct {
+		name     string
+		attempts int
+		err      error
+		want     time.Duration
+	}{
+		{"first retry", 1, errors.New("connection refused"), 30 * time.Second},
+		{"second retry", 2, errors.New("connection refused"), time.Minute},
+		{"doubles", 5, errors.New("connection refused"), 8 * time.Minute},
+		{"just under the cap", 10, errors.New("connection refused"), 256 * time.Minute},
+		{"capped", 11, errors.New("connection refused"), 6 * time.Hour},
+		{"no overflow", 70, errors.New("connection refused"), 6 * time.Hour},
+		{"longer retry-after wins", 1, retryAfter(10 * time.Minute), 10 * time.Minute},
+		{"shorter retry-after is ignored", 5, retryAfter(time.Minute), 8 * time.Minute},
+		{"retry-after is capped", 1, retryAfter(48 * time.Hour), 6 * time.Hour},
+		{"status without retry-after", 2, retryAfter(0), time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := webhookBackoff(tt.attempts, tt.err); got != tt.want {
+				t.Errorf("webhookBackoff(%d, %v) = %v, want %v", tt.attempts, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostWebhookSignsBody(t *testing.T) {
+	const secret = "s3cret"
+	body := []byte(`{"event":"post.created"}`)
+	deliveryID := uuid.New()
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(got)
+		if sig := r.Header.Get("X-Gator-Signature-256"); sig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("X-Gator-Signature-256 = %q", sig)
+		}
+		if string(got) != string(body) {
+			t.Errorf("body = %s", got)
+		}
+		if r.Header.Get("X-Gator-Event") != "post.created" || r.Header.Get("X-Gator-Delivery") != deliveryID.String() {
+			t.Errorf("headers = %v", r.Header)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	s := &state{fetcher: newTestFetcher(t, 0)}
+	status, err := s.postWebhook(context.Background(), receiver.URL, secret, deliveryID, body)
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("postWebhook = %d, %v", status, err)
+	}
+}
+
+func TestPostWebhookFailures(t *testing.T) {
+	var followed atomic.Bool
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed.Store(true)
+	}))
+	defer elsewhere.Close()
+
+	tests := []struct {
+		name           string
+		status         int
+		header         http.Header
+		wantRetryAfter time.Duration
+	}{
+		{"temporary redirect", http.StatusTemporaryRedirect, http.Header{"Location": {elsewhere.URL}}, 0},
+		{"permanent redirect", http.StatusMovedPermanently, http.Header{"Location": {elsewhere.URL}}, 0},
+		{"server error", http.StatusInternalServerError, nil, 0},
+		{"unavailable with retry-after", http.StatusServiceUnavailable, http.Header{"Retry-After": {"120"}}, 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, values := range tt.header {
+					w.Header()[key] = values
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer receiver.Close()
+
+			s := &state{fetcher: newTestFetcher(t, 0)}
+			status, err := s.postWebhook(context.Background(), receiver.URL, "s3cret", uuid.New(), []byte("{}"))
+			var statusErr *HTTPStatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("err = %v, want HTTPStatusError", err)
+			}
+			if status != tt.status || statusErr.StatusCode != tt.status {
+				t.Errorf("status = %d, error status = %d, want %d", status, statusErr.StatusCode, tt.status)
+			}
+			if statusErr.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("retry after = %v, want %v", statusErr.RetryAfter, tt.wantRetryAfter)
+			}
+		})
+	}
+	if followed.Load() {
+		t.Error("a redirect was followed")
+	}
+}
+
+func createTestWebhook(t *testing.T, s *state, user database.User, target string, feed *database.Feed, keyword string) database.Webhook {
+	t.Helper()
+	params := database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		Url:       target,
+		Keyword:   optionalString(keyword),
+		Secret:    "s3cret",
+	}
+	if feed != nil {
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	webhook, err := s.db.CreateWebhook(context.Background(), params)
+	if err != nil {
+		t.Fatalf("couldn't create webhook: %v", err)
+	}
+	return webhook
+}
+
+func webhookDeliveries(t *testing.T, s *state, user database.User, webhook database.Webhook) []database.GetWebhookDeliveriesRow {
+	t.Helper()
+	deliveries, err := s.db.GetWebhookDeliveries(context.Background(), database.GetWebhookDeliveriesParams{
+		WebhookID: webhook.ID,
+		UserID:    user.ID,
+		Limit:     10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deliveries
+}
+
+func TestEnqueueWebhookDeliveries(t *testing.T) {
+	s := newTestState(t)
+	ctx := context.Background()
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	followed := createTestFeed(t, s, alice, "https://example.com/feed.xml")
+	other := createTestFeed(t, s, bob, "https://example.org/feed.xml")
+
+	tests := []struct {
+		name    string
+		user    database.User
+		feed    *database.Feed
+		keyword string
+		want    int
+	}{
+		{"the post's feed", alice, &followed, "", 1},
+		{"another feed", alice, &other, "", 0},
+		{"every followed feed", alice, nil, "", 1},
+		{"keyword in the title", alice, nil, "GOPHERS", 1},
+		{"keyword in the description", alice, nil, "release", 1},
+		{"keyword only in markup", alice, nil, "href", 0},
+		{"missing keyword", alice, nil, "rust", 0},
+		{"feed and keyword", alice, &followed, "gophers", 1},
+		{"user not following the feed", bob, nil, "", 0},
+	}
+	webhooks := make([]database.Webhook, len(tests))
+	for i, tt := range tests {
+		webhooks[i] = createTestWebhook(t, s, tt.user, "https://hooks.example.com/"+tt.user.Name, tt.feed, tt.keyword)
+	}
+
+	result := scrapeResult{}
+	storeItems(ctx, s.db, followed.ID, []RSSItem{{
+		Title:       "News for Gophers",
+		Link:        "https://example.com/news",
+		Description: `<p>A new <a href="https://go.dev/">release</a> is out.</p>`,
+	}}, &result)
+	if result.inserted != 1 || len(result.postErrs) != 0 {
+		t.Fatalf("storeItems: inserted %d, errors %v", result.inserted, result.postErrs)
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(webhookDeliveries(t, s, tt.user, webhooks[i])); got != tt.want {
+				t.Errorf("got %d deliveries, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookDelivered(t *testing.T) {
+	s := newTestState(t)
+	ctx := context.Background()
+	alice := createTestUser(t, s, "alice")
+	feed := createTestFeed(t, s, alice, "https://example.com/feed.xml")
+
+	payloads := make(chan webhookPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		if sig := r.Header.Get("X-Gator-Signature-256"); sig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("X-Gator-Signature-256 = %q", sig)
+		}
+		var payload webhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Error(err)
+		}
+		payloads <- payload
+	}))
+	defer receiver.Close()
+	webhook := createTestWebhook(t, s, alice, receiver.URL, nil, "")
+
+	storeItems(ctx, s.db, feed.ID, []RSSItem{{Title: "First post", Link: "https://example.com/1"}}, &scrapeResult{})
+	s.deliverWebhooks(ctx)
+
+	payload := <-payloads
+	if payload.WebhookID != webhook.ID || payload.FeedURL != feed.Url || payload.Post.Title != "First post" {
+		t.Errorf("payload = %+v", payload)
+	}
+	deliveries := webhookDeliveries(t, s, alice, webhook)
+	if len(deliveries) != 1 || deliveries[0].State != "delivered" || !deliveries[0].DeliveredAt.Valid {
+		t.Errorf("deliveries = %+v", deliveries)
+	}
+}
+
+func TestWebhookRetriesUntilFailed(t *testing.T) {
+	s := newTestState(t)
+	ctx := context.Background()
+	alice := createTestUser(t, s, "alice")
+	feed := createTestFeed(t, s, alice, "https://example.com/feed.xml")
+
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+	webhook := createTestWebhook(t, s, alice, receiver.URL, nil, "")
+	storeItems(ctx, s.db, feed.ID, []RSSItem{{Title: "First post", Link: "https://example.com/1"}}, &scrapeResult{})
+
+	// Each attempt makes the delivery due again rather than waiting out
+	// the backoff.
+	retryNow := func() {
+		t.Helper()
+		if _, err := s.sqlDB.ExecContext(ctx, "UPDATE webhook_deliveries SET next_attempt_at = NOW()"); err != nil {
+			t.Fatal(err)
+		}
+		s.deliverWebhooks(ctx)
+	}
+
+	s.deliverWebhooks(ctx)
+	deliveries := webhookDeliveries(t, s, alice, webhook)
+	if len(deliveries) != 1 || deliveries[0].State != "pending" || deliveries[0].Attempts != 1 {
+		t.Fatalf("after the first attempt: deliveries = %+v", deliveries)
+	}
+	s.deliverWebhooks(ctx)
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("the delivery was retried before its backoff, %d attempts", got)
+	}
+
+	for range webhookMaxAttempts - 1 {
+		retryNow()
+	}
+	deliveries = webhookDeliveries(t, s, alice, webhook)
+	want := sql.NullInt32{Int32: http.StatusInternalServerError, Valid: true}
+	if len(deliveries) != 1 || deliveries[0].State != "failed" || deliveries[0].Attempts != webhookMaxAttempts || deliveries[0].LastStatus != want {
+		t.Fatalf("after %d attempts: deliveries = %+v", webhookMaxAttempts, deliveries)
+	}
+
+	retryNow()
+	if got := hits.Load(); got != webhookMaxAttempts {
+		t.Errorf("receiver was called %d times, want %d", got, webhookMaxAttempts)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/database"
+)
+
+const (
+	// websubLease is the lease requested from hubs, which may grant
+	// another one.
+	websubLease = 10 * 24 * time.Hour
+	// websubDefaultLease is assumed when a hub verifies a subscription
+	// without saying how long it lasts.
+	websubDefaultLease = 24 * time.Hour
+	// websubRenewBefore is how long before expiry a lease is renewed.
+	websubRenewBefore = 24 * time.Hour
+	// websubRetryAfter is how long a subscription request may go
+	// unverified before it is sent again.
+	websubRetryAfter    = time.Hour
+	websubCheckInterval = 10 * time.Minute
+)
+
+// subscribeDiscovered subscribes to the WebSub hub advertised by feed,
+// unless it is already subscribed or no public URL is configured for the
+// callback. Polling stops once the hub verifies the subscription.
+func (s *state) subscribeDiscovered(ctx context.Context, feed database.Feed, hub, self string) error {
+	if s.cfg.Serve.PublicURL == "" {
+		return nil
+	}
+	_, err := s.db.GetWebSubSubscriptionForFeed(ctx, feed.ID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	base, err := url.Parse(feed.Url)
+	if err != nil {
+		return err
+	}
+	hubURL, err := base.Parse(hub)
+	if err != nil {
+		return fmt.Errorf("invalid hub URL %q: %w", hub, err)
+	}
+	// The subscription secret must not travel in the clear, and pushes
+	// without a signature are ignored, so plain HTTP hubs are only polled.
+	if hubURL.Scheme != "https" {
+		slog.Debug("not subscribing to a WebSub hub without https", "feed_id", feed.ID, "hub_url", hubURL.String())
+		return nil
+	}
+	topic := feed.Url
+	if self != "" {
+		selfURL, err := base.Parse(self)
+		if err != nil {
+			return fmt.Errorf("invalid self URL %q: %w", self, err)
+		}
+		topic = selfURL.String()
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	sub, err := s.db.CreateWebSubSubscription(ctx, database.CreateWebSubSubscriptionParams{
+		ID:       uuid.New(),
+		FeedID:   feed.ID,
+		HubUrl:   hubURL.String(),
+		TopicUrl: topic,
+		Secret:   hex.EncodeToString(secret),
+		State:    "pending",
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't create subscription: %w", err)
+	}
+	return s.requestSubscription(ctx, sub)
+}
+
+// requestSubscription asks the hub to (re)subscribe sub. The hub confirms
+// asynchronously by calling the callback served by "gator serve". The
+// request carries the secret pushes are signed with, so it is only sent
+// over https.
+func (s *state) requestSubscription(ctx context.Context, sub database.WebsubSubscription) error {
+	if u, err := url.Parse(sub.HubUrl); err != nil || u.Scheme != "https" {
+		return fmt.Errorf("refusing to send the subscription secret to %s: not an https URL", sub.HubUrl)
+	}
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {sub.TopicUrl},
+		"hub.callback":      {s.websubCallback(sub.ID)},
+		"hub.secret":        {sub.Secret},
+		"hub.lease_seconds": {strconv.Itoa(int(websubLease.Seconds()))},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.HubUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", s.fetcher.userAgent)
+
+	resp, err := s.fetcher.client.Do(req)
+	if err != nil {
+		return classifyRequestError(sub.HubUrl, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &HTTPStatusError{URL: sub.HubUrl, StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// registerWebSub serves the callback hubs verify subscriptions and push
+// content to.
+func (s *state) registerWebSub(mux *http.ServeMux) {
+	mux.HandleFunc("GET /websub/{id}", s.handleWebSubVerify)
+	mux.HandleFunc("POST /websub/{id}", s.handleWebSubContent)
+}
+
+func (s *state) websubCallback(id uuid.UUID) string {
+	return strings.TrimRight(s.cfg.Serve.PublicURL, "/") + "/websub/" + id.String()
+}
+
+// renewWebSubSubscriptions re-sends the subscriptions whose lease is about
+// to expire and the ones a hub never verified. Leases are compared with the
+// database clock, like everywhere else they are read.
+func (s *state) renewWebSubSubscriptions(ctx context.Context) {
+	subs, err := s.db.GetWebSubSubscriptionsToRenew(ctx, database.GetWebSubSubscriptionsToRenewParams{
+		RenewWithinSeconds: websubRenewBefore.Seconds(),
+		RetryAfterSeconds:  websubRetryAfter.Seconds(),
+	})
+	if err != nil {
+		slog.Error("couldn't get WebSub subscriptions to renew", "error", err)
+		return
+	}
+
+	for _, sub := range subs {
+		err := s.db.SetWebSubSubscriptionState(ctx, database.SetWebSubSubscriptionStateParams{
+			ID:    sub.ID,
+			State: "pending",
+		})
+		if err != nil {
+			slog.Error("couldn't update WebSub subscription", "subscription_id", sub.ID, "error", err)
+			continue
+		}
+		if err := s.requestSubscription(ctx, sub); err != nil {
+			slog.Warn("couldn't renew WebSub subscription", "feed_id", sub.FeedID, "feed_url", sub.TopicUrl, "error", err)
+		}
+	}
+}
+
+// handleWebSubVerify answers the hub's verification of intent. Only
+// subscriptions we asked for are confirmed; we never unsubscribe.
+func (s *state) handleWebSubVerify(w http.ResponseWriter, r *http.Request) {
+	sub, ok := s.lookupSubscription(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	switch query.Get("hub.mode") {
+	case "subscribe":
+		if query.Get("hub.topic") != sub.TopicUrl || sub.State == "denied" {
+			http.NotFound(w, r)
+			return
+		}
+		lease := websubDefaultLease
+		if seconds, err := strconv.Atoi(query.Get("hub.lease_seconds")); err == nil && seconds > 0 {
+			lease = time.Duration(seconds) * time.Second
+		}
+		err := s.db.ActivateWebSubSubscription(r.Context(), database.ActivateWebSubSubscriptionParams{
+			ID:           sub.ID,
+			LeaseSeconds: lease.Seconds(),
+		})
+		if err != nil {
+			slog.Error("couldn't activate WebSub subscription", "subscription_id", sub.ID, "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		slog.Info("WebSub subscription verified", "feed_id", sub.FeedID, "feed_url", sub.TopicUrl, "lease", lease)
+		// The challenge is echoed verbatim, so it must not be sniffed as
+		// HTML.
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		io.WriteString(w, query.Get("hub.challenge"))
+	case "denied":
+		err := s.db.SetWebSubSubscriptionState(r.Context(), database.SetWebSubSubscriptionStateParams{
+			ID:    sub.ID,
+			State: "denied",
+		})
+		if err != nil {
+			slog.Error("couldn't update WebSub subscription", "subscription_id", sub.ID, "error", err)
+		}
+		slog.Warn("WebSub subscription denied", "feed_id", sub.FeedID, "feed_url", sub.TopicUrl, "reason", query.Get("hub.reason"))
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleWebSubContent stores the items of a content distribution request.
+// Content with a missing or wrong signature is acknowledged but ignored,
+// as the WebSub spec requires.
+func (s *state) handleWebSubContent(w http.ResponseWriter, r *http.Request) {
+	sub, ok := s.lookupSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.fetcher.maxBytes+1))
+	if err != nil {
+		http.Error(w, "couldn't read body", http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > s.fetcher.maxBytes {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !validHubSignature(sub.Secret, r.Header.Get("X-Hub-Signature"), body) {
+		slog.Warn("ignoring WebSub content with an invalid signature", "feed_id", sub.FeedID, "feed_url", sub.TopicUrl)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	feed, err := s.db.GetFeedById(r.Context(), sub.FeedID)
+	if err != nil {
+		slog.Error("couldn't get feed for WebSub subscription", "subscription_id", sub.ID, "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	logger := slog.With("feed_id", feed.ID, "feed_url", feed.Url)
+	result := scrapeResult{feedID: feed.ID, pushed: true}
+	parsed, warnings, parseErr := parseFeed(body, r.Header.Get("Content-Type"))
+	result.parseWarnings = warnings
+	if parseErr == nil {
+		storeItems(r.Context(), s.db, feed.ID, parsed.Channel.Item, &result)
+	} else {
+		parseErr = &ParseError{URL: feed.Url, Err: parseErr}
+	}
+	if err := recordFetch(r.Context(), s.db, feed.ID, result, parseErr); err != nil {
+		logger.Error("couldn't record fetch", "error", err)
+	}
+	if parseErr != nil {
+		logger.Warn("ignoring WebSub content", "error", parseErr)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	for _, err := range result.postErrs {
+		logger.Error("couldn't create post", "error", err)
+	}
+	logger.Info("feed pushed",
+		"feed_name", feed.Name,
+		"posts_found", result.found,
+		"posts_inserted", result.inserted,
+		"parse_warnings", result.parseWarnings)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *state) lookupSubscription(w http.ResponseWriter, r *http.Request) (database.WebsubSubscription, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return database.WebsubSubscription{}, false
+	}
+	sub, err := s.db.GetWebSubSubscription(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return sub, false
+	}
+	if err != nil {
+		slog.Error("couldn't get WebSub subscription", "subscription_id", id, "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return sub, false
+	}
+	return sub, true
+}
+
+// validHubSignature checks an X-Hub-Signature header of the form
+// "sha256=<hex HMAC of body>".
+func validHubSignature(secret, header string, body []byte) bool {
+	method, signature, ok := strings.Cut(header, "=")
+	if !ok {
+		return false
+	}
+	var newHash func() hash.Hash
+	switch strings.ToLower(method) {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "sha384":
+		newHash = sha512.New384
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
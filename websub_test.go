@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/zyaeger/gator/internal/config"
+	"github.com/zyaeger/gator/internal/database"
+)
+
+func hubSignature(newHash func() hash.Hash, secret string, body []byte) string {
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidHubSignature(t *testing.T) {
+	const secret = "s3cret"
+	body := []byte(testFeed)
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"sha256", "sha256=" + hubSignature(sha256.New, secret, body), true},
+		{"sha1", "sha1=" + hubSignature(sha1.New, secret, body), true},
+		{"sha384", "sha384=" + hubSignature(sha512.New384, secret, body), true},
+		{"upper-case method", "SHA512=" + hubSignature(sha512.New, secret, body), true},
+		{"missing", "", false},
+		{"no method", hubSignature(sha256.New, secret, body), false},
+		{"unknown method", "md5=" + hubSignature(sha256.New, secret, body), false},
+		{"method mismatch", "sha1=" + hubSignature(sha256.New, secret, body), false},
+		{"wrong secret", "sha256=" + hubSignature(sha256.New, "other", body), false},
+		{"other body", "sha256=" + hubSignature(sha256.New, secret, []byte("<rss/>")), false},
+		{"not hex", "sha256=zz", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validHubSignature(secret, tt.header, body); got != tt.want {
+				t.Errorf("validHubSignature(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestSubscriptionRefusesPlainHTTP(t *testing.T) {
+	var contacted atomic.Bool
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contacted.Store(true)
+	}))
+	defer hub.Close()
+
+	s := &state{
+		cfg:     &config.Config{Serve: config.ServeConfig{PublicURL: "https://gator.example.com"}},
+		fetcher: newTestFetcher(t, 0),
+	}
+	sub := database.WebsubSubscription{ID: uuid.New(), HubUrl: hub.URL, TopicUrl: "https://example.com/feed.xml", Secret: "s3cret"}
+	if err := s.requestSubscription(context.Background(), sub); err == nil {
+		t.Error("expected an error for a plain HTTP hub")
+	}
+	if contacted.Load() {
+		t.Error("the hub was sent the secret")
+	}
+}
+
+// newWebSubTestServer serves s's WebSub callback and points the public URL
+// at it.
+func newWebSubTestServer(t *testing.T, s *state) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	s.registerWebSub(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	s.cfg.Serve.PublicURL = srv.URL
+	return srv
+}
+
+func TestWebSubSubscribeVerifyAndPush(t *testing.T) {
+	s := newTestState(t)
+	ctx := context.Background()
+	callback := newWebSubTestServer(t, s)
+
+	requests := make(chan url.Values, 1)
+	hub := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		requests <- r.PostForm
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer hub.Close()
+	s.fetcher.client.Transport = hub.Client().Transport
+
+	user := createTestUser(t, s, "alice")
+	feed := createTestFeed(t, s, user, "https://example.com/feed.xml")
+	if err := s.subscribeDiscovered(ctx, feed, hub.URL, ""); err != nil {
+		t.Fatalf("subscribeDiscovered: %v", err)
+	}
+	form := <-requests
+	if form.Get("hub.mode") != "subscribe" || form.Get("hub.topic") != feed.Url || form.Get("hub.secret") == "" {
+		t.Fatalf("subscription request = %v", form)
+	}
+	callbackURL := form.Get("hub.callback")
+	if !strings.HasPrefix(callbackURL, callback.URL+"/websub/") {
+		t.Fatalf("hub.callback = %q", callbackURL)
+	}
+
+	verify := func(topic string) *http.Response {
+		t.Helper()
+		query := url.Values{
+			"hub.mode":          {"subscribe"},
+			"hub.topic":         {topic},
+			"hub.challenge":     {"<script>alert(1)</script>"},
+			"hub.lease_seconds": {"3600"},
+		}
+		resp, err := http.Get(callbackURL + "?" + query.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	if resp := verify("https://example.com/other.xml"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("verifying another topic: status = %d, want 404", resp.StatusCode)
+	}
+	resp := verify(feed.Url)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "<script>alert(1)</script>" {
+		t.Fatalf("verification: status = %d, body = %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q", got)
+	}
+	sub, err := s.db.GetWebSubSubscriptionForFeed(ctx, feed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.State != "active" {
+		t.Errorf("state = %q, want active", sub.State)
+	}
+
+	push := func(signature string) int {
+		t.Helper()
+		req, err := http.NewRequest("POST", callbackURL, strings.NewReader(testFeed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/rss+xml")
+		if signature != "" {
+			req.Header.Set("X-Hub-Signature", signature)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	posts := func() []database.GetPostsForFeedRow {
+		t.Helper()
+		posts, err := s.db.GetPostsForFeed(ctx, database.GetPostsForFeedParams{UserID: user.ID, FeedID: feed.ID, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return posts
+	}
+
+	for _, signature := range []string{"", "sha256=" + hubSignature(sha256.New, "wrong", []byte(testFeed))} {
+		if status := push(signature); status != http.StatusAccepted {
+			t.Errorf("push signed %q: status = %d, want 202", signature, status)
+		}
+	}
+	if got := posts(); len(got) != 0 {
+		t.Fatalf("unsigned pushes stored %d posts", len(got))
+	}
+
+	if status := push("sha256=" + hubSignature(sha256.New, form.Get("hub.secret"), []byte(testFeed))); status != http.StatusNoContent {
+		t.Fatalf("signed push: status = %d, want 204", status)
+	}
+	if got := posts(); len(got) != 1 || got[0].Title != "First post" {
+		t.Errorf("posts = %+v", got)
+	}
+}
+
+func TestWebSubSkipsPlainHTTPHub(t *testing.T) {
+	s := newTestState(t)
+	s.cfg.Serve.PublicURL = "https://gator.example.com"
+	var contacted atomic.Bool
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contacted.Store(true)
+	}))
+	defer hub.Close()
+
+	feed := createTestFeed(t, s, createTestUser(t, s, "alice"), "https://example.com/feed.xml")
+	if err := s.subscribeDiscovered(context.Background(), feed, hub.URL, ""); err != nil {
+		t.Fatalf("subscribeDiscovered: %v", err)
+	}
+	if contacted.Load() {
+		t.Error("a plain HTTP hub was contacted")
+	}
+	if _, err := s.db.GetWebSubSubscriptionForFeed(context.Background(), feed.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("subscription lookup: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestWebSubUnknownSubscription(t *testing.T) {
+	s := newTestState(t)
+	srv := newWebSubTestServer(t, s)
+
+	for _, id := range []string{uuid.NewString(), "not-a-uuid"} {
+		query := url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"https://example.com/feed.xml"}, "hub.challenge": {"echo"}}
+		resp, err := http.Get(srv.URL + "/websub/" + id + "?" + query.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound || string(body) == "echo" {
+			t.Errorf("verify %s: status = %d, body = %q", id, resp.StatusCode, body)
+		}
+
+		resp, err = http.Post(srv.URL+"/websub/"+id, "application/rss+xml", strings.NewReader(testFeed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("push to %s: status = %d, want 404", id, resp.StatusCode)
+		}
+	}
+}